@@ -35,26 +35,26 @@ func main() {
 			config.FileSource[map[any]any]{Path: "/etc/configloader.yml"},
 			config.FileSource[map[any]any]{
 				Path: "/etc/configloader.tmpl.yml",
-				Unmarshal: config.
-					YamlValueTemplateUnmarshal[map[any]any](nil),
+				UnmarshalContext: config.
+					YamlValueTemplateUnmarshalContext[map[any]any](nil),
 			},
 			config.DirSource[map[any]any]{Path: "/etc/configloader.d"},
 			config.DirSource[map[any]any]{
 				Path: "/etc/configloader.tmpl.d",
-				Unmarshal: config.
-					YamlValueTemplateUnmarshal[map[any]any](nil),
+				UnmarshalContext: config.
+					YamlValueTemplateUnmarshalContext[map[any]any](nil),
 			},
 			config.FileSource[map[any]any]{Path: "~/.config/configloader.yml"},
 			config.FileSource[map[any]any]{
 				Path: "~/.config/configloader.tmpl.yml",
-				Unmarshal: config.
-					YamlValueTemplateUnmarshal[map[any]any](nil),
+				UnmarshalContext: config.
+					YamlValueTemplateUnmarshalContext[map[any]any](nil),
 			},
 			config.DirSource[map[any]any]{Path: "~/.config/configloader.d"},
 			config.DirSource[map[any]any]{
 				Path: "~/.config/configloader.tmpl.d",
-				Unmarshal: config.
-					YamlValueTemplateUnmarshal[map[any]any](nil),
+				UnmarshalContext: config.
+					YamlValueTemplateUnmarshalContext[map[any]any](nil),
 			},
 		},
 	}
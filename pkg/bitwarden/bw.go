@@ -0,0 +1,208 @@
+package bitwarden
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/pastdev/configloader/pkg/log"
+)
+
+// bwItem is the subset of the json output by `bw get item` that maps onto
+// Entry.
+type bwItem struct {
+	Fields []struct {
+		LinkedID *int   `json:"linkedId"`
+		Name     string `json:"name"`
+		Type     int    `json:"type"`
+		Value    string `json:"value"`
+	} `json:"fields"`
+	FolderID string `json:"folderId"`
+	ID       string `json:"id"`
+	Login    struct {
+		Password string `json:"password"`
+		Totp     string `json:"totp"`
+		Uris     []struct {
+			Match *int   `json:"match"`
+			URI   string `json:"uri"`
+		} `json:"uris"`
+		Username string `json:"username"`
+	} `json:"login"`
+	Name            string `json:"name"`
+	Notes           string `json:"notes"`
+	PasswordHistory []struct {
+		LastUsedDate string `json:"lastUsedDate"`
+		Password     string `json:"password"`
+	} `json:"passwordHistory"`
+}
+
+// bwFieldTypes are the names rbw uses for the field types of bw.
+var bwFieldTypes = []string{"text", "hidden", "boolean", "linked"}
+
+// bwCLI runs the commands of a bw client. The item ids (bw decrypts every
+// item to list them) and the folders rarely change, so each is listed once and
+// kept for the lifetime of the client.
+type bwCLI struct {
+	folders map[string]string
+	ids     []string
+	mu      sync.Mutex
+}
+
+// NewBw returns a client using the official [bw] cli. The vault must be
+// unlocked with the session exported as $BW_SESSION, bw is never allowed to
+// prompt for the master password.
+//
+// [bw]: https://bitwarden.com/help/cli/
+func NewBw() *Client {
+	cli := &bwCLI{}
+	return &Client{
+		ListIDs: cli.listIDs,
+		Lookup:  cli.lookup,
+		Status:  bwStatus,
+	}
+}
+
+// bw runs the bw cli without allowing it to prompt for input.
+func bw(args ...string) ([]byte, error) {
+	return run(append([]string{"bw", "--nointeraction"}, args...)...)
+}
+
+func (c *bwCLI) listIDs() ([]string, error) {
+	log.Logger.Trace().Str("provider", "bitwarden").Msg("listIDs")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids != nil {
+		return slices.Clone(c.ids), nil
+	}
+
+	stdout, err := bw("list", "items")
+	if err != nil {
+		return nil, err
+	}
+
+	// only the ids are decoded so that the secrets are not retained
+	var items []struct {
+		ID string `json:"id"`
+	}
+	err = json.Unmarshal(stdout, &items)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal bw items: %w", err)
+	}
+
+	c.ids = make([]string, len(items))
+	for i, item := range items {
+		c.ids[i] = item.ID
+	}
+	return slices.Clone(c.ids), nil
+}
+
+// folder returns the name of the folder with id.
+func (c *bwCLI) folder(id string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.folders == nil {
+		stdout, err := bw("list", "folders")
+		if err != nil {
+			return "", err
+		}
+		var folders []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		err = json.Unmarshal(stdout, &folders)
+		if err != nil {
+			return "", fmt.Errorf("unmarshal bw folders: %w", err)
+		}
+
+		c.folders = make(map[string]string, len(folders))
+		for _, folder := range folders {
+			c.folders[folder.ID] = folder.Name
+		}
+	}
+	return c.folders[id], nil
+}
+
+// lookup returns the item converted to the json format of `rbw get --raw`.
+func (c *bwCLI) lookup(id string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "bitwarden").Str("id", id).Msg("getJSON")
+	stdout, err := bw("get", "item", id)
+	if err != nil {
+		return nil, err
+	}
+
+	var item bwItem
+	err = json.Unmarshal(stdout, &item)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal bw item: %w", err)
+	}
+
+	entry := Entry{
+		Data: Data{
+			Password: item.Login.Password,
+			Totp:     item.Login.Totp,
+			Username: item.Login.Username,
+		},
+		ID:    item.ID,
+		Name:  item.Name,
+		Notes: item.Notes,
+	}
+	for _, field := range item.Fields {
+		fieldType := ""
+		if field.Type >= 0 && field.Type < len(bwFieldTypes) {
+			fieldType = bwFieldTypes[field.Type]
+		}
+		var linkedID int
+		if field.LinkedID != nil {
+			linkedID = *field.LinkedID
+		}
+		entry.Fields = append(entry.Fields, Field{LinkedID: linkedID, Name: field.Name, Type: fieldType, Value: field.Value})
+	}
+	for _, history := range item.PasswordHistory {
+		entry.History = append(entry.History, History{LastUsedDate: history.LastUsedDate, Password: history.Password})
+	}
+	for _, uri := range item.Login.Uris {
+		converted := URI{DefaultMatch: uri.Match == nil, URI: uri.URI}
+		if uri.Match != nil {
+			converted.MatchType = *uri.Match
+		}
+		entry.Data.Uris = append(entry.Data.Uris, converted)
+	}
+
+	if item.FolderID != "" {
+		entry.Folder, err = c.folder(item.FolderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("marshal bw item: %w", err)
+	}
+	return b, nil
+}
+
+func bwStatus() error {
+	stdout, err := bw("status")
+	if err != nil {
+		return err
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	err = json.Unmarshal(stdout, &status)
+	if err != nil {
+		return fmt.Errorf("unmarshal bw status: %w", err)
+	}
+
+	switch status.Status {
+	case "unlocked":
+		return nil
+	case "unauthenticated":
+		return errors.New("bw not logged in, run `bw login` and try again")
+	}
+	return errors.New("bw vault locked, run `bw unlock`, export BW_SESSION and try again")
+}
@@ -5,14 +5,31 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// Attributes of a login that linked fields can refer to.
+const (
+	linkedUsername = 100
+	linkedPassword = 101
 )
 
 type Client struct {
+	// ListIDs returns the ids of all entries.
+	ListIDs func() ([]string, error)
+	// Lookup returns the entry json in the format of `rbw get --raw` (the
+	// json of other clis is converted to this format).
 	Lookup func(id string) ([]byte, error)
+	// Status returns an error if the vault is not unlocked.
+	Status func() error
 }
 
 type Data struct {
@@ -33,7 +50,11 @@ type Entry struct {
 }
 
 type Field struct {
-	Name  string `json:"name"`
+	// LinkedID identifies the attribute a linked field refers to (ie: 100
+	// for the username and 101 for the password of a login).
+	LinkedID int    `json:"linked_id,omitempty"`
+	Name     string `json:"name"`
+	// Type is one of text, hidden, boolean or linked.
 	Type  string `json:"type"`
 	Value string `json:"value"`
 }
@@ -44,14 +65,99 @@ type History struct {
 }
 
 type URI struct {
+	// DefaultMatch is true if the URI uses the default match detection (see
+	// DefaultMatchType), in which case MatchType is unused. It is encoded as
+	// a null match_type.
+	DefaultMatch bool `json:"-"`
+	// MatchType is the index of the match type in MatchTypes.
 	MatchType int    `json:"match_type"`
 	URI       string `json:"uri"`
 }
 
+// uriJSON is the json encoding of URI.
+type uriJSON struct {
+	MatchType *int   `json:"match_type"`
+	URI       string `json:"uri"`
+}
+
+// MarshalJSON implements [json.Marshaler].
+func (u URI) MarshalJSON() ([]byte, error) {
+	encoded := uriJSON{URI: u.URI}
+	if !u.DefaultMatch {
+		encoded.MatchType = &u.MatchType
+	}
+	b, err := json.Marshal(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("marshal bitwarden uri: %w", err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON implements [json.Unmarshaler].
+func (u *URI) UnmarshalJSON(b []byte) error {
+	var decoded uriJSON
+	err := json.Unmarshal(b, &decoded)
+	if err != nil {
+		return fmt.Errorf("unmarshal bitwarden uri: %w", err)
+	}
+	*u = URI{DefaultMatch: decoded.MatchType == nil, URI: decoded.URI}
+	if decoded.MatchType != nil {
+		u.MatchType = *decoded.MatchType
+	}
+	return nil
+}
+
+// DefaultMatchType is the name used to select the URIs that use the default
+// match detection, rather than one of MatchTypes.
+const DefaultMatchType = "default"
+
+// MatchTypes are the names of the URI match types, indexed by their value.
+var MatchTypes = []string{"domain", "host", "startsWith", "exact", "regularExpression", "never"}
+
+var (
+	_ secrets.CachingProvider = Client{}
+	_ secrets.FuncProvider    = Client{}
+)
+
 func (c Client) AddFuncs(funcs map[string]any) {
 	funcs["bitwardenField"] = c.GetField
 	funcs["bitwardenFormat"] = c.GetFormat
+	funcs["bitwardenHistory"] = c.GetHistory
 	funcs["bitwardenJSON"] = c.GetJSON
+	funcs["bitwardenTOTP"] = c.GetTOTP
+	funcs["bitwardenURI"] = c.GetURI
+}
+
+// Check implements [secrets.Provider].
+func (c Client) Check() error {
+	if c.Status == nil {
+		return nil
+	}
+	return c.Status()
+}
+
+// Get implements [secrets.Provider] returning the password of the entry.
+func (c Client) Get(id string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Data.Password, nil
+}
+
+// List implements [secrets.Provider].
+func (c Client) List() ([]string, error) {
+	if c.ListIDs == nil {
+		return nil, fmt.Errorf("list bitwarden: %w", secrets.ErrNotSupported)
+	}
+	return c.ListIDs()
+}
+
+// WithCache implements [secrets.CachingProvider].
+func (c Client) WithCache(cache *secrets.Cache) secrets.Provider {
+	c.Lookup = cache.Wrap("bitwarden", c.Lookup)
+	return c
 }
 
 func (c Client) GetJSON(id string) (string, error) {
@@ -63,6 +169,8 @@ func (c Client) GetJSON(id string) (string, error) {
 	return string(data), nil
 }
 
+// GetField implements [secrets.Provider] returning the value of the custom
+// field with the supplied name (see Entry.FieldValue), or "" if there is none.
 func (c Client) GetField(id string, name string) (string, error) {
 	entry, err := c.unmarshal(id)
 	if err != nil {
@@ -71,7 +179,7 @@ func (c Client) GetField(id string, name string) (string, error) {
 
 	for _, field := range entry.Fields {
 		if field.Name == name {
-			return field.Value, nil
+			return entry.FieldValue(field)
 		}
 	}
 
@@ -84,7 +192,39 @@ func (c Client) GetFormat(id string, format string, name ...string) (string, err
 		return "", err
 	}
 
-	return entry.Format(format, name...), nil
+	return entry.FormatAttributes(format, name...)
+}
+
+// GetHistory returns a previous password of the entry, 0 being the most
+// recently replaced.
+func (c Client) GetHistory(id string, index int) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.PreviousPassword(index)
+}
+
+// GetTOTP returns the current TOTP code generated from the seed of the entry.
+func (c Client) GetTOTP(id string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.TOTP(time.Now())
+}
+
+// GetURI returns a URI of the entry, selected by index (ie: 0), or by match
+// type (ie: "exact", see MatchTypes and DefaultMatchType).
+func (c Client) GetURI(id string, selector any) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.URI(selector)
 }
 
 func (c Client) unmarshal(id string) (*Entry, error) {
@@ -96,44 +236,200 @@ func (c Client) unmarshal(id string) (*Entry, error) {
 	var entry Entry
 	err = json.Unmarshal(data, &entry)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal rbw entry: %w", err)
+		return nil, fmt.Errorf("unmarshal bitwarden entry: %w", err)
 	}
 
 	return &entry, nil
 }
 
+// FieldValue returns the value of field. The values of boolean fields are
+// normalized to true or false, and linked fields return the value of the
+// attribute they are linked to.
+func (e *Entry) FieldValue(field Field) (string, error) {
+	switch field.Type {
+	case "boolean":
+		b, err := strconv.ParseBool(field.Value)
+		if err != nil {
+			// bitwarden treats anything but true as false
+			return "false", nil //nolint:nilerr // intentional
+		}
+		return strconv.FormatBool(b), nil
+	case "linked":
+		switch field.LinkedID {
+		case linkedUsername:
+			return e.Data.Username, nil
+		case linkedPassword:
+			return e.Data.Password, nil
+		}
+		return "", fmt.Errorf("bitwarden field %s linked to unsupported attribute %d", field.Name, field.LinkedID)
+	}
+	return field.Value, nil
+}
+
+// Format returns format populated with the entry attributes in name (see
+// FormatAttributes). Attributes that cannot be resolved are formatted as nil.
 func (e *Entry) Format(format string, name ...string) string {
 	formatArgs := make([]any, len(name))
 	for i, n := range name {
-		var v any
-		switch n {
-		case "folder":
-			v = e.Folder
-		case "id":
-			v = e.ID
-		case "name":
-			v = e.Name
-		case "notes":
-			v = e.Notes
-		case "password":
-			v = e.Data.Password
-		case "username":
-			v = e.Data.Username
+		v, err := e.attribute(n)
+		if err == nil {
+			formatArgs[i] = v
 		}
-		formatArgs[i] = v
 	}
 
 	return fmt.Sprintf(format, formatArgs...)
 }
 
+// FormatAttributes returns format populated with the entry attributes in name.
+// Supported names are: folder, id, name, notes, password, previous_password
+// (the most recently replaced password), totp (the current code), uri (the
+// first URI), and username. An error is returned for any other name, or if
+// the entry has no value for the attribute (ie: no totp seed).
+func (e *Entry) FormatAttributes(format string, name ...string) (string, error) {
+	formatArgs := make([]any, len(name))
+	for i, n := range name {
+		v, err := e.attribute(n)
+		if err != nil {
+			return "", err
+		}
+		formatArgs[i] = v
+	}
+
+	return fmt.Sprintf(format, formatArgs...), nil
+}
+
+func (e *Entry) attribute(name string) (string, error) {
+	switch name {
+	case "folder":
+		return e.Folder, nil
+	case "id":
+		return e.ID, nil
+	case "name":
+		return e.Name, nil
+	case "notes":
+		return e.Notes, nil
+	case "password":
+		return e.Data.Password, nil
+	case "previous_password":
+		return e.PreviousPassword(0)
+	case "totp":
+		return e.TOTP(time.Now())
+	case "uri":
+		return e.URI(0)
+	case "username":
+		return e.Data.Username, nil
+	}
+	return "", fmt.Errorf("unknown bitwarden attribute: %s", name)
+}
+
+// PreviousPassword returns a previous password, 0 being the most recently
+// replaced.
+func (e *Entry) PreviousPassword(index int) (string, error) {
+	history := slices.Clone(e.History)
+	slices.SortStableFunc(history, func(a, b History) int {
+		return strings.Compare(b.LastUsedDate, a.LastUsedDate)
+	})
+	if index < 0 || index >= len(history) {
+		return "", fmt.Errorf("bitwarden entry %s has %d previous passwords: %d", e.Name, len(history), index)
+	}
+	return history[index].Password, nil
+}
+
+// TOTP returns the TOTP code for now generated from the seed of the entry.
+func (e *Entry) TOTP(now time.Time) (string, error) {
+	if e.Data.Totp == "" {
+		return "", fmt.Errorf("bitwarden entry %s has no totp seed", e.Name)
+	}
+	return TOTP(e.Data.Totp, now)
+}
+
+// URI returns a URI of the entry, selected by index, or by the name of its
+// match type (see MatchTypes and DefaultMatchType).
+func (e *Entry) URI(selector any) (string, error) {
+	switch typed := selector.(type) {
+	case int:
+		if typed < 0 || typed >= len(e.Data.Uris) {
+			return "", fmt.Errorf("bitwarden entry %s has %d uris: %d", e.Name, len(e.Data.Uris), typed)
+		}
+		return e.Data.Uris[typed].URI, nil
+	case string:
+		matches := func(uri URI) bool { return uri.DefaultMatch }
+		if !strings.EqualFold(typed, DefaultMatchType) {
+			matchType := slices.IndexFunc(MatchTypes, func(name string) bool { return strings.EqualFold(name, typed) })
+			if matchType < 0 {
+				return "", fmt.Errorf(
+					"unknown bitwarden uri match type, expected one of %s, %s: %s",
+					DefaultMatchType,
+					strings.Join(MatchTypes, ", "),
+					typed)
+			}
+			matches = func(uri URI) bool { return !uri.DefaultMatch && uri.MatchType == matchType }
+		}
+		for _, uri := range e.Data.Uris {
+			if matches(uri) {
+				return uri.URI, nil
+			}
+		}
+		return "", fmt.Errorf("bitwarden entry %s has no uri with match type %s", e.Name, typed)
+	}
+	return "", fmt.Errorf("bitwarden uri selector must be an index or match type: %v", selector)
+}
+
+// New returns a client using the bitwarden cli selected by $BITWARDEN_CLI
+// (rbw or bw). If not set, rbw is used if installed, otherwise bw if
+// installed.
 func New() *Client {
-	return &Client{Lookup: lookup}
+	switch os.Getenv("BITWARDEN_CLI") {
+	case "bw":
+		return NewBw()
+	case "rbw":
+		return NewRbw()
+	}
+	if _, err := exec.LookPath("rbw"); err != nil {
+		if _, err := exec.LookPath("bw"); err == nil {
+			return NewBw()
+		}
+	}
+	return NewRbw()
+}
+
+// NewRbw returns a client using the unofficial [rbw] cli.
+//
+// [rbw]: https://github.com/doy/rbw
+func NewRbw() *Client {
+	return &Client{
+		ListIDs: listIDs,
+		Lookup:  lookup,
+		Status:  status,
+	}
+}
+
+func listIDs() ([]string, error) {
+	log.Logger.Trace().Str("provider", "bitwarden").Msg("listIDs")
+	stdout, err := run("rbw", "list", "--fields", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(stdout)), nil
+}
+
+func status() error {
+	_, err := run("rbw", "unlocked")
+	if err != nil {
+		return fmt.Errorf("rbw vault locked, run `rbw unlock` and try again: %w", err)
+	}
+	return nil
 }
 
 func lookup(id string) ([]byte, error) {
 	log.Logger.Trace().Str("provider", "bitwarden").Str("id", id).Msg("getJSON")
-	//nolint:gosec // id is safe in command getting invoked
-	cmd := exec.Command("rbw", "get", id, "--raw")
+	return run("rbw", "get", id, "--raw")
+}
+
+func run(args ...string) ([]byte, error) {
+	//nolint:gosec // args are safe in command getting invoked
+	cmd := exec.Command(args[0], args[1:]...)
 
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
@@ -142,10 +438,15 @@ func lookup(id string) ([]byte, error) {
 	err := cmd.Run()
 	if err != nil {
 		errStr := stderr.String()
-		if strings.Contains(strings.ToLower(errStr), "failed to read password from pinentry") {
+		switch lower := strings.ToLower(errStr); {
+		case strings.Contains(lower, "failed to read password from pinentry"):
 			return nil, errors.New("rbw agent not active, run `rbw unlock` and try again")
+		case strings.Contains(lower, "vault is locked"):
+			return nil, errors.New("bw vault locked, run `bw unlock`, export BW_SESSION and try again")
+		case strings.Contains(lower, "you are not logged in"):
+			return nil, errors.New("bw not logged in, run `bw login` and try again")
 		}
-		return nil, fmt.Errorf("run rbw (%s): %w", stderr.String(), err)
+		return nil, fmt.Errorf("run %s (%s): %w", args[0], errStr, err)
 	}
 
 	return stdout.Bytes(), nil
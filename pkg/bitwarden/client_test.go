@@ -1,9 +1,16 @@
 package bitwarden_test
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pastdev/configloader/pkg/bitwarden"
+	"github.com/pastdev/configloader/pkg/secrets"
 	"github.com/stretchr/testify/require"
 )
 
@@ -141,3 +148,338 @@ func TestFormat(t *testing.T) {
 			"user/newpwd")
 	})
 }
+
+func TestProvider(t *testing.T) {
+	client := staticLookupClient(`{
+  "id": "d7213953-c6bf-468a-b220-b32c00fc75a0",
+  "name": "example.org",
+  "data": {
+    "username": "user",
+    "password": "pass"
+  },
+  "fields": [
+    {
+      "name": "username",
+      "value": "custom-user",
+      "type": "text"
+    }
+  ],
+  "notes": "These are some notes"
+}`)
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := client.Get("")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("field is not an attribute", func(t *testing.T) {
+		actual, err := client.GetField("", "notes")
+		require.NoError(t, err)
+		require.Equal(t, "", actual)
+	})
+
+	t.Run("custom field", func(t *testing.T) {
+		actual, err := client.GetField("", "username")
+		require.NoError(t, err)
+		require.Equal(t, "custom-user", actual)
+	})
+
+	t.Run("list not supported", func(t *testing.T) {
+		_, err := client.List()
+		require.ErrorIs(t, err, secrets.ErrNotSupported)
+	})
+}
+
+func TestBw(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("bw stand in is a shell script")
+	}
+
+	// a stand in for bw that outputs canned json and logs its commands
+	bin := t.TempDir()
+	log := filepath.Join(t.TempDir(), "log")
+	t.Setenv("BW_TEST_LOG", log)
+	require.NoError(t, os.WriteFile(
+		filepath.Join(bin, "bw"),
+		[]byte(`#!/bin/sh
+echo "$*" >>"$BW_TEST_LOG"
+case "$*" in
+"--nointeraction status")
+  echo '{"status":"'"${BW_TEST_STATUS:-unlocked}"'"}'
+  ;;
+"--nointeraction list items")
+  echo '[{"id":"id-1","name":"example.org"},{"id":"id-2","name":"example.com"}]'
+  ;;
+"--nointeraction list folders")
+  echo '[{"object":"folder","id":"folder-1","name":"web"}]'
+  ;;
+"--nointeraction get item example.org")
+  cat <<'JSON'
+{
+  "object": "item",
+  "id": "id-1",
+  "folderId": "folder-1",
+  "type": 1,
+  "name": "example.org",
+  "notes": "some notes",
+  "fields": [
+    {"name": "api_key", "value": "key", "type": 1, "linkedId": null},
+    {"name": "enabled", "value": "true", "type": 2, "linkedId": null},
+    {"name": "secret", "value": null, "type": 3, "linkedId": 101}
+  ],
+  "login": {
+    "uris": [{"match": null, "uri": "https://example.org"}, {"match": 3, "uri": "https://example.org/login"}],
+    "username": "user",
+    "password": "pass",
+    "totp": "JBSWY3DPEHPK3PXP"
+  },
+  "passwordHistory": [{"lastUsedDate": "2025-08-01T17:07:43.855Z", "password": "oldpass"}]
+}
+JSON
+  ;;
+*)
+  echo "Vault is locked." >&2
+  exit 1
+  ;;
+esac
+`),
+		0o700))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("BITWARDEN_CLI", "bw")
+
+	client := bitwarden.New()
+
+	t.Run("check", func(t *testing.T) {
+		require.NoError(t, client.Check())
+
+		t.Setenv("BW_TEST_STATUS", "locked")
+		require.ErrorContains(t, client.Check(), "bw vault locked")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		ids, err := client.List()
+		require.NoError(t, err)
+		require.Equal(t, []string{"id-1", "id-2"}, ids)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := client.Get("example.org")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("field", func(t *testing.T) {
+		actual, err := client.GetField("example.org", "api_key")
+		require.NoError(t, err)
+		require.Equal(t, "key", actual)
+
+		actual, err = client.GetField("example.org", "secret")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("format", func(t *testing.T) {
+		actual, err := client.GetFormat("example.org", "%s/%s:%s", "folder", "username", "password")
+		require.NoError(t, err)
+		require.Equal(t, "web/user:pass", actual)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		actual, err := client.GetJSON("example.org")
+		require.NoError(t, err)
+		require.JSONEq(t,
+			`{
+  "id": "id-1",
+  "folder": "web",
+  "name": "example.org",
+  "notes": "some notes",
+  "data": {
+    "username": "user",
+    "password": "pass",
+    "totp": "JBSWY3DPEHPK3PXP",
+    "uris": [
+      {"uri": "https://example.org", "match_type": null},
+      {"uri": "https://example.org/login", "match_type": 3}
+    ]
+  },
+  "fields": [
+    {"name": "api_key", "value": "key", "type": "hidden"},
+    {"name": "enabled", "value": "true", "type": "boolean"},
+    {"name": "secret", "value": "", "type": "linked", "linked_id": 101}
+  ],
+  "history": [{"last_used_date": "2025-08-01T17:07:43.855Z", "password": "oldpass"}]
+}`,
+			actual)
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		_, err := client.Get("other")
+		require.ErrorContains(t, err, "bw vault locked")
+	})
+
+	t.Run("listed once", func(t *testing.T) {
+		ids, err := client.List()
+		require.NoError(t, err)
+		require.Equal(t, []string{"id-1", "id-2"}, ids)
+
+		b, err := os.ReadFile(log)
+		require.NoError(t, err)
+		require.Equal(t, 1, strings.Count(string(b), "list items\n"))
+		require.Equal(t, 1, strings.Count(string(b), "list folders\n"))
+	})
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 test vectors
+	tests := []struct {
+		seed     string
+		time     int64
+		expected string
+	}{
+		{"otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8", 59, "94287082"},
+		{"otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&digits=8", 1111111109, "07081804"},
+		{
+			"otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA&digits=8&algorithm=SHA256",
+			59,
+			"46119246",
+		},
+		{
+			"otpauth://totp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA&digits=8&algorithm=SHA512",
+			59,
+			"90693936",
+		},
+		{"gezd gnbv gy3t qojq gezd gnbv gy3t qojq", 59, "287082"},
+	}
+	for _, test := range tests {
+		actual, err := bitwarden.TOTP(test.seed, time.Unix(test.time, 0))
+		require.NoError(t, err)
+		require.Equal(t, test.expected, actual, test.seed)
+	}
+
+	_, err := bitwarden.TOTP("steam://ABCDEFGH", time.Now())
+	require.ErrorIs(t, err, secrets.ErrNotSupported)
+}
+
+func TestEntryAttributes(t *testing.T) {
+	client := staticLookupClient(`{
+  "id": "d7213953-c6bf-468a-b220-b32c00fc75a0",
+  "name": "example.org",
+  "data": {
+    "username": "user",
+    "password": "newpwd",
+    "totp": "otpauth://totp/example.org?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+    "uris": [
+      {"uri": "https://example.org", "match_type": 0},
+      {"uri": "https://example.org/login", "match_type": 3},
+      {"uri": "https://login.example.org", "match_type": null}
+    ]
+  },
+  "fields": [
+    {"name": "api_key", "value": "key", "type": "hidden"},
+    {"name": "enabled", "value": "TRUE", "type": "boolean"},
+    {"name": "disabled", "value": "", "type": "boolean"},
+    {"name": "login", "value": "", "type": "linked", "linked_id": 100},
+    {"name": "card", "value": "", "type": "linked", "linked_id": 300}
+  ],
+  "history": [
+    {"last_used_date": "2025-08-01T17:07:23.424Z", "password": "origpwd"},
+    {"last_used_date": "2025-08-01T17:07:43.855Z", "password": "midpwd"}
+  ]
+}`)
+
+	t.Run("totp", func(t *testing.T) {
+		actual, err := client.GetTOTP("")
+		require.NoError(t, err)
+		require.Regexp(t, `^\d{6}$`, actual)
+	})
+
+	t.Run("uri", func(t *testing.T) {
+		actual, err := client.GetURI("", 1)
+		require.NoError(t, err)
+		require.Equal(t, "https://example.org/login", actual)
+
+		actual, err = client.GetURI("", "exact")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.org/login", actual)
+
+		actual, err = client.GetURI("", "default")
+		require.NoError(t, err)
+		require.Equal(t, "https://login.example.org", actual)
+
+		actual, err = client.GetURI("", "domain")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.org", actual)
+
+		_, err = client.GetURI("", 3)
+		require.ErrorContains(t, err, "has 3 uris")
+
+		_, err = client.GetURI("", "host")
+		require.ErrorContains(t, err, "no uri with match type host")
+	})
+
+	t.Run("history", func(t *testing.T) {
+		actual, err := client.GetHistory("", 0)
+		require.NoError(t, err)
+		require.Equal(t, "midpwd", actual)
+
+		actual, err = client.GetHistory("", 1)
+		require.NoError(t, err)
+		require.Equal(t, "origpwd", actual)
+
+		_, err = client.GetHistory("", 2)
+		require.Error(t, err)
+	})
+
+	t.Run("typed fields", func(t *testing.T) {
+		for name, expected := range map[string]string{
+			"api_key":  "key",
+			"enabled":  "true",
+			"disabled": "false",
+			"login":    "user",
+		} {
+			actual, err := client.GetField("", name)
+			require.NoError(t, err)
+			require.Equal(t, expected, actual, name)
+		}
+
+		_, err := client.GetField("", "card")
+		require.ErrorContains(t, err, "unsupported attribute 300")
+	})
+
+	t.Run("format", func(t *testing.T) {
+		actual, err := client.GetFormat("", "%s %s", "uri", "previous_password")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.org midpwd", actual)
+
+		actual, err = client.GetFormat("", "%s", "totp")
+		require.NoError(t, err)
+		require.Regexp(t, `^\d{6}$`, actual)
+
+		_, err = client.GetFormat("", "%s", "card")
+		require.ErrorContains(t, err, "unknown bitwarden attribute: card")
+
+		_, err = staticLookupClient(`{"name": "example.org"}`).GetFormat("", "%s", "totp")
+		require.ErrorContains(t, err, "has no totp seed")
+
+		entry := bitwarden.Entry{Data: bitwarden.Data{Username: "user"}}
+		require.Equal(t, "user %!s(<nil>)", entry.Format("%s %s", "username", "card"))
+	})
+
+	t.Run("uri json", func(t *testing.T) {
+		uris := []bitwarden.URI{
+			{MatchType: 3, URI: "https://example.org/login"},
+			{DefaultMatch: true, URI: "https://login.example.org"},
+		}
+		b, err := json.Marshal(uris)
+		require.NoError(t, err)
+		require.JSONEq(t,
+			`[{"match_type": 3, "uri": "https://example.org/login"}, {"match_type": null, "uri": "https://login.example.org"}]`,
+			string(b))
+
+		var actual []bitwarden.URI
+		err = json.Unmarshal(b, &actual)
+		require.NoError(t, err)
+		require.Equal(t, uris, actual)
+	})
+}
@@ -0,0 +1,85 @@
+package bitwarden
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec // sha1 is the default totp algorithm
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// TOTP returns the RFC 6238 code for now generated from seed, which is either
+// a base32 encoded secret or an `otpauth://totp/...` URI (which may specify
+// the algorithm, digits and period).
+func TOTP(seed string, now time.Time) (string, error) {
+	secret := seed
+	algorithm := "SHA1"
+	digits := 6
+	period := 30
+	if strings.HasPrefix(seed, "otpauth://") {
+		u, err := url.Parse(seed)
+		if err != nil {
+			return "", fmt.Errorf("parse totp uri: %w", err)
+		}
+		query := u.Query()
+		secret = query.Get("secret")
+		if v := query.Get("algorithm"); v != "" {
+			algorithm = strings.ToUpper(v)
+		}
+		if v := query.Get("digits"); v != "" {
+			digits, err = strconv.Atoi(v)
+			if err != nil || digits < 1 || digits > 10 {
+				return "", fmt.Errorf("invalid totp digits: %s", v)
+			}
+		}
+		if v := query.Get("period"); v != "" {
+			period, err = strconv.Atoi(v)
+			if err != nil || period < 1 {
+				return "", fmt.Errorf("invalid totp period: %s", v)
+			}
+		}
+	} else if strings.Contains(seed, "://") {
+		return "", fmt.Errorf("totp seed %s: %w", strings.SplitN(seed, "://", 2)[0], secrets.ErrNotSupported)
+	}
+
+	var newHash func() hash.Hash
+	switch algorithm {
+	case "SHA1":
+		newHash = sha1.New
+	case "SHA256":
+		newHash = sha256.New
+	case "SHA512":
+		newHash = sha512.New
+	default:
+		return "", fmt.Errorf("totp algorithm %s: %w", algorithm, secrets.ErrNotSupported)
+	}
+
+	secret = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("decode totp secret: %w", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/int64(period)))
+	mac := hmac.New(newHash, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	code := uint64(binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff)
+	modulus := uint64(1)
+	for range digits {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%modulus), nil
+}
@@ -3,8 +3,9 @@ package cobra
 import (
 	"fmt"
 	"io"
-	"os"
+	"slices"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/pastdev/configloader/pkg/config"
 	"github.com/spf13/cobra"
@@ -13,10 +14,26 @@ import (
 
 const OutputYaml = "yaml"
 
+// DefaultRedactPaths are the key paths masked by the config subcommand unless
+// --show-secrets is passed. See config.Redaction for the glob syntax.
+var DefaultRedactPaths = []string{"**.password", "**.secret", "**.token"}
+
 type ConfigCommandOption[T any] func(*ConfigCommandOptions[T])
 
 type ConfigCommandOptions[T any] struct {
-	Output       map[string]func(w io.Writer, cfg *T) error
+	// NodeOutput are formatters of the config keyed by name, like Output,
+	// that receive the config encoded as a yaml.Node in which masked values
+	// of any type are replaced (see config.RedactNode). The default yaml
+	// formatter is one of these. Output formatters take precedence.
+	NodeOutput map[string]func(w io.Writer, cfg *yaml.Node) error
+	// Output are the formatters of the config keyed by name. They receive a
+	// copy of the config with its secrets masked (see config.Redact) unless
+	// --show-secrets is passed.
+	Output map[string]func(w io.Writer, cfg *T) error
+	// Redaction determines the values that are masked unless --show-secrets
+	// is passed. In addition, struct fields tagged `secret:"true"`, and
+	// values rendered by templates calling secret functions are masked.
+	Redaction    config.Redaction
 	SilenceUsage bool
 }
 
@@ -27,9 +44,14 @@ type ConfigLoader[T any] struct {
 	// DefaultSources are sources that you can configure in the code and allow
 	// for the flags to replace at runtime.
 	DefaultSources config.Sources[T]
-	loaded         bool
-	overrides      []configOverride[T]
-	sources        config.Sources[T]
+	// LoadOptions are passed to the Load of the resolved sources.
+	LoadOptions []config.LoadOption
+	loaded      bool
+	overrides   []configOverride[T]
+	// secretPaths are the paths of the values rendered by templates calling
+	// secret functions
+	secretPaths []string
+	sources     config.Sources[T]
 }
 
 // Config returns the generated configuration object that will be loaded by the
@@ -56,24 +78,40 @@ func (c *ConfigLoader[T]) Config() (*T, error) {
 // then the DefaultSources will be ignored. Otherwise, configurationis loaded
 // from the DefaultSources.
 func (c *ConfigLoader[T]) load() error {
-	var sources config.Sources[T]
+	opts := append(slices.Clip(c.LoadOptions), config.WithSecretPaths(&c.secretPaths))
+	if err := c.resolveSources().Load(&c.config, opts...); err != nil {
+		return fmt.Errorf("configloader load sources: %w", err)
+	}
 
-	if len(c.sources) == 0 {
-		sources = c.DefaultSources
-	} else {
-		for _, src := range c.DefaultSources {
-			if isBaseSource(src) {
-				sources = append(sources, src)
-			}
-		}
-		sources = append(sources, c.sources...)
+	return nil
+}
+
+// secretReferences loads the configuration without fetching any secrets
+// returning the secrets that would be fetched.
+func (c *ConfigLoader[T]) secretReferences() ([]config.SecretReference, error) {
+	var cfg T
+	var references []config.SecretReference
+	opts := append(slices.Clip(c.LoadOptions), config.WithSecretAudit(&references))
+	if err := c.resolveSources().Load(&cfg, opts...); err != nil {
+		return nil, fmt.Errorf("configloader audit sources: %w", err)
 	}
+	return references, nil
+}
 
-	if err := sources.Load(&c.config); err != nil {
-		return fmt.Errorf("configloader load sources: %w", err)
+// resolveSources returns the sources set using the persistent flags, along
+// with the base DefaultSources, or the DefaultSources if none were set.
+func (c *ConfigLoader[T]) resolveSources() config.Sources[T] {
+	if len(c.sources) == 0 {
+		return c.DefaultSources
 	}
 
-	return nil
+	var sources config.Sources[T]
+	for _, src := range c.DefaultSources {
+		if isBaseSource(src) {
+			sources = append(sources, src)
+		}
+	}
+	return append(sources, c.sources...)
 }
 
 // PersistentFlags returns a factory for adding configuration source flags to
@@ -88,11 +126,15 @@ func (c *ConfigLoader[T]) PersistentFlags(root *cobra.Command) *flags[T] {
 }
 
 // AddSubCommandTo will add a config subcommand to the supplied root command.
-// This subcommand will print out the configuration.
+// This subcommand will print out the configuration. Secrets (see
+// ConfigCommandOptions.Redaction) are masked before the configuration is
+// passed to the output formatter unless the --show-secrets flag is passed.
+// A `config secrets` subcommand prints the secrets the configuration
+// references without fetching them (see config.WithSecretAudit).
 func (c *ConfigLoader[T]) AddSubCommandTo(root *cobra.Command, opts ...ConfigCommandOption[T]) {
 	options := ConfigCommandOptions[T]{
-		Output: map[string]func(w io.Writer, cfg *T) error{
-			OutputYaml: func(w io.Writer, cfg *T) error {
+		NodeOutput: map[string]func(w io.Writer, cfg *yaml.Node) error{
+			OutputYaml: func(w io.Writer, cfg *yaml.Node) error {
 				err := yaml.NewEncoder(w).Encode(cfg)
 				if err != nil {
 					return fmt.Errorf("serialize config: %w", err)
@@ -100,30 +142,60 @@ func (c *ConfigLoader[T]) AddSubCommandTo(root *cobra.Command, opts ...ConfigCom
 				return nil
 			},
 		},
+		Output:    map[string]func(w io.Writer, cfg *T) error{},
+		Redaction: config.Redaction{Paths: slices.Clone(DefaultRedactPaths)},
 	}
 	for _, opt := range opts {
 		opt(&options)
 	}
 
 	output := OutputYaml
+	showSecrets := false
 
 	cmd := cobra.Command{
 		Use:          "config",
 		Short:        `Print out the config data.`,
 		Args:         cobra.NoArgs,
 		SilenceUsage: options.SilenceUsage,
-		RunE: func(_ *cobra.Command, _ []string) error {
+		RunE: func(cmd *cobra.Command, _ []string) error {
 			cfg, err := c.Config()
 			if err != nil {
 				return fmt.Errorf("get config: %w", err)
 			}
 
-			formatter, ok := options.Output[output]
+			redaction := options.Redaction
+			redaction.SecretPaths = c.secretPaths
+			if formatter, ok := options.Output[output]; ok {
+				if showSecrets {
+					revealed := config.RevealSecrets(*cfg)
+					cfg = &revealed
+				} else {
+					cfg = config.Redact(cfg, redaction)
+				}
+				err = formatter(cmd.OutOrStdout(), cfg)
+				if err != nil {
+					return fmt.Errorf("format config: %w", err)
+				}
+				return nil
+			}
+
+			formatter, ok := options.NodeOutput[output]
 			if !ok {
 				return fmt.Errorf("undefined formatter: %s", output)
 			}
 
-			err = formatter(os.Stdout, cfg)
+			var node *yaml.Node
+			if showSecrets {
+				node = &yaml.Node{}
+				err = node.Encode(config.RevealSecrets(cfg))
+			} else {
+				node, err = config.RedactNode(cfg, redaction)
+			}
+			if err != nil {
+				return fmt.Errorf("encode config: %w", err)
+			}
+
+			err = formatter(cmd.OutOrStdout(), node)
 			if err != nil {
 				return fmt.Errorf("format config: %w", err)
 			}
@@ -131,10 +203,21 @@ func (c *ConfigLoader[T]) AddSubCommandTo(root *cobra.Command, opts ...ConfigCom
 		},
 	}
 
-	formatters := make([]string, 0, len(options.Output))
+	cmd.Flags().BoolVar(
+		&showSecrets,
+		"show-secrets",
+		false,
+		"Print secret values rather than masking them")
+
+	formatters := make([]string, 0, len(options.Output)+len(options.NodeOutput))
 	for formatter := range options.Output {
 		formatters = append(formatters, formatter)
 	}
+	for formatter := range options.NodeOutput {
+		if _, ok := options.Output[formatter]; !ok {
+			formatters = append(formatters, formatter)
+		}
+	}
 
 	if len(formatters) > 1 {
 		cmd.Flags().StringVar(
@@ -147,6 +230,30 @@ func (c *ConfigLoader[T]) AddSubCommandTo(root *cobra.Command, opts ...ConfigCom
 		output = "yaml"
 	}
 
+	cmd.AddCommand(&cobra.Command{
+		Use:          "secrets",
+		Short:        `Print the secrets referenced by the config without fetching them.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: options.SilenceUsage,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			references, err := c.secretReferences()
+			if err != nil {
+				return fmt.Errorf("get secret references: %w", err)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PATH\tPROVIDER\tID\tFIELD")
+			for _, reference := range references {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", reference.Path, reference.Provider, reference.ID, reference.Field)
+			}
+			err = w.Flush()
+			if err != nil {
+				return fmt.Errorf("print secret references: %w", err)
+			}
+			return nil
+		},
+	})
+
 	root.AddCommand(&cmd)
 }
 
@@ -159,6 +266,26 @@ func WithConfigCommandOutput[T any](
 	}
 }
 
+// WithConfigCommandNodeOutput adds a formatter that receives the config
+// encoded as a yaml.Node (see ConfigCommandOptions.NodeOutput).
+func WithConfigCommandNodeOutput[T any](
+	name string,
+	formatter func(w io.Writer, cfg *yaml.Node) error,
+) ConfigCommandOption[T] {
+	return func(cco *ConfigCommandOptions[T]) {
+		cco.NodeOutput[name] = formatter
+	}
+}
+
+// WithConfigCommandRedactPaths adds key path globs (ie: `**.api_key`) to the
+// paths masked by the config subcommand. See config.Redaction for the glob
+// syntax.
+func WithConfigCommandRedactPaths[T any](paths ...string) ConfigCommandOption[T] {
+	return func(cco *ConfigCommandOptions[T]) {
+		cco.Redaction.Paths = append(cco.Redaction.Paths, paths...)
+	}
+}
+
 func WithConfigCommandSilenceUsage[T any](s bool) ConfigCommandOption[T] {
 	return func(cco *ConfigCommandOptions[T]) {
 		cco.SilenceUsage = s
@@ -2,10 +2,14 @@
 package cobra
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"text/template"
 
 	"github.com/pastdev/configloader/pkg/config"
 	cobracmd "github.com/spf13/cobra"
@@ -393,3 +397,181 @@ name: from-file
 		)
 	})
 }
+
+func TestConfigSubCommand(t *testing.T) {
+	type DB struct {
+		Password string `yaml:"password"`
+		URL      string `yaml:"url"`
+		User     string `yaml:"user" secret:"true"`
+	}
+	type Cfg struct {
+		APIKey   string                `yaml:"api_key"`
+		DB       DB                    `yaml:"db"`
+		Name     string                `yaml:"name"`
+		Port     int                   `yaml:"port"`
+		Secret   config.Secret[string] `yaml:"secret_value"`
+		Template string                `yaml:"template"`
+		Token    string                `yaml:"token"`
+	}
+
+	tester := func(t *testing.T, args []string, opts []ConfigCommandOption[Cfg], expected string) {
+		t.Helper()
+
+		unmarshal := config.YamlValueTemplateUnmarshalContext[Cfg](
+			config.NewTemplate(
+				template.FuncMap{"secret": func(id string) string { return "secret-" + id }},
+				config.WithPrefetch(1, "secret")))
+		loader := &ConfigLoader[Cfg]{
+			DefaultSources: config.Sources[Cfg]{
+				config.RawSource[Cfg]{
+					Data: []byte(`
+api_key: key
+db:
+  password: pass
+  url: postgres://localhost
+  user: app
+name: default
+port: 8080
+secret_value: value
+template: '{{ secret "template" }}'
+token: token
+`),
+					UnmarshalContext: unmarshal,
+				},
+			},
+		}
+
+		root := &cobracmd.Command{Use: "test"}
+		loader.AddSubCommandTo(root, opts...)
+
+		var out bytes.Buffer
+		root.SetOut(&out)
+		root.SetArgs(append([]string{"config"}, args...))
+		if _, err := root.ExecuteC(); err != nil {
+			t.Fatalf("execute config: %v", err)
+		}
+
+		if out.String() != expected {
+			t.Fatalf("got:\n%s\nwant:\n%s", out.String(), expected)
+		}
+
+		cfg, err := loader.Config()
+		if err != nil {
+			t.Fatalf("config: %v", err)
+		}
+		if cfg.Secret.Value() != "value" || cfg.DB.Password != "pass" {
+			t.Fatalf("config was modified: %+v", cfg)
+		}
+	}
+
+	t.Run("redacted", func(t *testing.T) {
+		tester(t, nil, nil, `api_key: key
+db:
+    password: '***'
+    url: postgres://localhost
+    user: '***'
+name: default
+port: 8080
+secret_value: '***'
+template: '***'
+token: '***'
+`)
+	})
+
+	t.Run("redact paths", func(t *testing.T) {
+		tester(t,
+			nil,
+			[]ConfigCommandOption[Cfg]{WithConfigCommandRedactPaths[Cfg]("*_key", "db.url", "port")},
+			`api_key: '***'
+db:
+    password: '***'
+    url: '***'
+    user: '***'
+name: default
+port: '***'
+secret_value: '***'
+template: '***'
+token: '***'
+`)
+	})
+
+	t.Run("show secrets", func(t *testing.T) {
+		tester(t, []string{"--show-secrets"}, nil, `api_key: key
+db:
+    password: pass
+    url: postgres://localhost
+    user: app
+name: default
+port: 8080
+secret_value: value
+template: secret-template
+token: token
+`)
+	})
+
+	t.Run("typed output", func(t *testing.T) {
+		formatter := func(w io.Writer, cfg *Cfg) error {
+			_, err := fmt.Fprintf(w, "%s %s %s %d %s\n", cfg.APIKey, cfg.DB.Password, cfg.DB.User, cfg.Port, cfg.Template)
+			return err
+		}
+		tester(t,
+			[]string{"--output", "text"},
+			[]ConfigCommandOption[Cfg]{
+				WithConfigCommandOutput[Cfg]("text", formatter),
+				WithConfigCommandRedactPaths[Cfg]("port"),
+			},
+			"key *** *** 0 ***\n")
+		tester(t,
+			[]string{"--output", "text", "--show-secrets"},
+			[]ConfigCommandOption[Cfg]{WithConfigCommandOutput[Cfg]("text", formatter)},
+			"key pass app 8080 secret-template\n")
+	})
+}
+
+func TestConfigSecretsSubCommand(t *testing.T) {
+	type Cfg struct {
+		Name     string `yaml:"name"`
+		Password string `yaml:"password"`
+		Token    string `yaml:"token"`
+	}
+
+	unmarshal := config.YamlValueTemplateUnmarshalContext[Cfg](
+		config.NewTemplate(
+			template.FuncMap{
+				"secret": func(_ string, _ string, _ ...string) (string, error) {
+					t.Fatal("secret fetched")
+					return "", nil
+				},
+			},
+			config.WithPrefetch(1, "secret")))
+	loader := &ConfigLoader[Cfg]{
+		DefaultSources: config.Sources[Cfg]{
+			config.RawSource[Cfg]{
+				Data: []byte(`
+name: default
+password: '{{ secret "bitwarden" "example.com" }}'
+token: '{{ secret "vault" "secret/app" "token" }}'
+`),
+				UnmarshalContext: unmarshal,
+			},
+		},
+	}
+
+	root := &cobracmd.Command{Use: "test"}
+	loader.AddSubCommandTo(root)
+
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"config", "secrets"})
+	if _, err := root.ExecuteC(); err != nil {
+		t.Fatalf("execute config secrets: %v", err)
+	}
+
+	expected := `PATH       PROVIDER   ID           FIELD
+/password  bitwarden  example.com  
+/token     vault      secret/app   token
+`
+	if out.String() != expected {
+		t.Fatalf("got:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
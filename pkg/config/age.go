@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/pastdev/configloader/pkg/xdg"
+)
+
+// ErrNoAgeIdentities is returned when age encrypted data is loaded but no
+// identities are configured.
+var ErrNoAgeIdentities = errors.New("no age identities")
+
+// AgeDecrypt returns an Unmarshal function that decrypts age encrypted data
+// (binary or armored) before passing it to unmarshal (YamlUnmarshal if nil).
+// If no identities are supplied, AgeIdentities is used when the data is
+// decrypted.
+func AgeDecrypt[T any](
+	unmarshal func(ctx context.Context, b []byte, cfg *T) error,
+	identities ...age.Identity,
+) func(ctx context.Context, b []byte, cfg *T) error {
+	if unmarshal == nil {
+		unmarshal = withoutContext(YamlUnmarshal[T]())
+	}
+	return func(ctx context.Context, b []byte, cfg *T) error {
+		decrypted, err := ageDecrypt(b, identities)
+		if err != nil {
+			return err
+		}
+		return unmarshal(ctx, decrypted, cfg)
+	}
+}
+
+// AgeIdentities returns the identities in $AGE_IDENTITY if set, otherwise
+// those in the file at $AGE_IDENTITY_FILE, which defaults to age/keys.txt in
+// xdg.ConfigHome().
+func AgeIdentities() ([]age.Identity, error) {
+	if identity := os.Getenv("AGE_IDENTITY"); identity != "" {
+		identities, err := age.ParseIdentities(strings.NewReader(identity))
+		if err != nil {
+			return nil, fmt.Errorf("parse AGE_IDENTITY: %w", err)
+		}
+		return identities, nil
+	}
+
+	file := os.Getenv("AGE_IDENTITY_FILE")
+	if file == "" {
+		configHome, err := xdg.ConfigHome()
+		if err != nil {
+			return nil, fmt.Errorf("age identity file: %w", err)
+		}
+		file = filepath.Join(configHome, "age", "keys.txt")
+	}
+	return AgeIdentitiesFromFile(file)
+}
+
+// AgeIdentitiesFromFile returns the identities in file (ie: one generated by
+// age-keygen).
+func AgeIdentitiesFromFile(file string) ([]age.Identity, error) {
+	f, err := os.Open(normalizePath(file))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: set AGE_IDENTITY or create %s", ErrNoAgeIdentities, file)
+	} else if err != nil {
+		return nil, fmt.Errorf("open age identity file: %w", err)
+	}
+	defer f.Close()
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse age identity file %s: %w", file, err)
+	}
+	return identities, nil
+}
+
+func ageDecrypt(b []byte, identities []age.Identity) ([]byte, error) {
+	if len(identities) == 0 {
+		var err error
+		identities, err = AgeIdentities()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var in io.Reader = bytes.NewReader(b)
+	if trimmed := bytes.TrimSpace(b); bytes.HasPrefix(trimmed, []byte(armor.Header)) {
+		in = armor.NewReader(bytes.NewReader(trimmed))
+	}
+
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("age decrypt: %w", err)
+	}
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("age decrypt: %w", err)
+	}
+	return decrypted, nil
+}
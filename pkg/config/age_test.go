@@ -0,0 +1,104 @@
+package config_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func ageEncrypt(t *testing.T, recipient age.Recipient, armored bool, plain string) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	var dst io.Writer = &out
+	var armorWriter io.WriteCloser
+	if armored {
+		armorWriter = armor.NewWriter(&out)
+		dst = armorWriter
+	}
+	w, err := age.Encrypt(dst, recipient)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, plain)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	if armorWriter != nil {
+		require.NoError(t, armorWriter.Close())
+	}
+	return out.Bytes()
+}
+
+func TestAge(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	type Config struct {
+		Password string `yaml:"password"`
+		Username string `yaml:"username"`
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yml"), []byte(`username: user`), 0o600))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "b.yml.age"),
+		ageEncrypt(t, identity.Recipient(), false, `password: pass`),
+		0o600))
+
+	t.Run("extension detection", func(t *testing.T) {
+		t.Setenv("AGE_IDENTITY", identity.String())
+
+		var cfg Config
+		err := config.Sources[Config]{config.DirSource[Config]{Path: dir}}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, Config{Password: "pass", Username: "user"}, cfg)
+	})
+
+	t.Run("identity file", func(t *testing.T) {
+		keys := filepath.Join(t.TempDir(), "keys.txt")
+		require.NoError(t, os.WriteFile(
+			keys,
+			[]byte("# created: 2025-01-01T00:00:00Z\n"+other.String()+"\n"+identity.String()+"\n"),
+			0o600))
+		t.Setenv("AGE_IDENTITY", "")
+		t.Setenv("AGE_IDENTITY_FILE", keys)
+
+		var cfg Config
+		err := config.FileSource[Config]{Path: filepath.Join(dir, "b.yml.age")}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, Config{Password: "pass"}, cfg)
+	})
+
+	t.Run("armored wrapper", func(t *testing.T) {
+		var cfg Config
+		err := config.RawSource[Config]{
+			Data:             ageEncrypt(t, identity.Recipient(), true, `{"username": "user"}`),
+			UnmarshalContext: config.AgeDecrypt[Config](nil, identity),
+		}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, Config{Username: "user"}, cfg)
+	})
+
+	t.Run("wrong identity", func(t *testing.T) {
+		t.Setenv("AGE_IDENTITY", other.String())
+
+		var cfg Config
+		err := config.FileSource[Config]{Path: filepath.Join(dir, "b.yml.age")}.Load(&cfg)
+		require.ErrorContains(t, err, "age decrypt: no identity matched any of the recipients")
+	})
+
+	t.Run("no identities", func(t *testing.T) {
+		t.Setenv("AGE_IDENTITY", "")
+		t.Setenv("AGE_IDENTITY_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+
+		var cfg Config
+		err := config.FileSource[Config]{Path: filepath.Join(dir, "b.yml.age")}.Load(&cfg)
+		require.ErrorIs(t, err, config.ErrNoAgeIdentities)
+	})
+}
@@ -0,0 +1,320 @@
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// SecretReference is a call to a secret function recorded by WithSecretAudit.
+type SecretReference struct {
+	// Field is the field (or comma separated fields) of the entry, if any.
+	Field string `json:"field,omitempty" yaml:"field,omitempty"`
+	// Func is the name of the template function.
+	Func string `json:"func" yaml:"func"`
+	// ID identifies the entry within the provider. Arguments that are the
+	// result of another secret function are shown as `<secret>`.
+	ID string `json:"id" yaml:"id"`
+	// Path is the path of the value (ie: /db/password).
+	Path string `json:"path" yaml:"path"`
+	// Provider is the name of the provider of the function in the registry of
+	// the Template (see WithRegistry), or Func if the function is not from a
+	// registry.
+	Provider string `json:"provider" yaml:"provider"`
+}
+
+// auditExecutor records the secret calls a value would make without
+// executing it.
+type auditExecutor struct {
+	caller secretCaller
+	calls  *[]secretCall
+}
+
+// WithSecretAudit will load without fetching any secrets (a dry run), setting
+// references to the secret function calls the templates of
+// YamlValueTemplateUnmarshalContext would have made. The templates are not
+// executed, so the values of those sources are not loaded into cfg. Instead,
+// the calls are found by parsing the templates, so calls in every branch (ie:
+// of an if or range) are included, and arguments are shown as written unless
+// they are literals or fields of the template data (ie: .Env.USER). Only the
+// functions added by WithRegistry, named in WithPrefetch, or named as one of
+// the secret functions of DefaultFuncMap are recorded. With
+// WithDeferredTemplates, calls in values overridden by a later source are not
+// included, and the loaded values hold the templates themselves (see
+// WithDeferredTemplates for the fields that can hold them).
+func WithSecretAudit(references *[]SecretReference) LoadOption {
+	return func(o *loadOptions) {
+		o.secretAudit = references
+	}
+}
+
+func (a auditExecutor) Execute(name string, value any) (any, error) {
+	calls, err := a.caller.auditCalls(name, value)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	*a.calls = append(*a.calls, calls...)
+	return value, nil
+}
+
+// auditCalls returns the calls to secret functions found in the parse tree
+// of value.
+func (t *Template) auditCalls(name string, value any) ([]secretCall, error) {
+	str, ok := value.(string)
+	if !ok || !strings.Contains(str, "{{") {
+		return nil, nil
+	}
+
+	tmpl, err := t.cache.value(str)
+	if err != nil {
+		return nil, fmt.Errorf("new template %s: %w", name, err)
+	}
+
+	a := auditor{data: t.templateData(), path: name, providers: t.secretProviders()}
+	templates := tmpl.Templates()
+	slices.SortFunc(templates, func(a, b *template.Template) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	for _, tmpl := range templates {
+		if tmpl.Tree != nil {
+			a.node(tmpl.Tree.Root)
+		}
+	}
+	return a.calls, nil
+}
+
+// secretFuncProviders returns the provider of each of the functions of the
+// Template that look up secrets, keyed by function name. These are the
+// functions added by WithRegistry, named in WithPrefetch, or named as one of
+// the secret functions of DefaultFuncMap. The provider is empty if it is not
+// known (ie: for the generic secret function).
+func (t *Template) secretFuncProviders() map[string]string {
+	providers := map[string]string{}
+	for name, provider := range defaultSecretProviders() {
+		if _, ok := t.funcMap[name]; ok {
+			providers[name] = provider
+		}
+	}
+	if t.registry != nil {
+		for _, name := range t.registry.FuncNames() {
+			providers[name] = ""
+		}
+		maps.Copy(providers, t.registry.FuncProviders())
+	}
+	if t.prefetch != nil {
+		for _, name := range t.prefetch.funcs {
+			if _, ok := providers[name]; !ok {
+				providers[name] = ""
+			}
+		}
+	}
+	return providers
+}
+
+// defaultSecretProviders returns the provider of each of the secret functions
+// of DefaultFuncMap, keyed by function name.
+var defaultSecretProviders = sync.OnceValue(func() map[string]string {
+	registry := DefaultRegistry()
+	providers := registry.FuncProviders()
+	for _, name := range registry.FuncNames() {
+		if _, ok := providers[name]; !ok {
+			providers[name] = ""
+		}
+	}
+	return providers
+})
+
+// auditor collects the secret calls of a parse tree.
+type auditor struct {
+	calls []secretCall
+	data  *TemplateData
+	// dotRebound is true within the body of a range or with, where dot is no
+	// longer the template data
+	dotRebound bool
+	path       string
+	// providers of the secret functions, keyed by function name
+	providers map[string]string
+}
+
+func (a *auditor) node(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			a.node(child)
+		}
+	case *parse.ActionNode:
+		a.pipe(n.Pipe)
+	case *parse.TemplateNode:
+		a.pipe(n.Pipe)
+	case *parse.IfNode:
+		a.branch(&n.BranchNode, false)
+	case *parse.RangeNode:
+		a.branch(&n.BranchNode, true)
+	case *parse.WithNode:
+		a.branch(&n.BranchNode, true)
+	}
+}
+
+// branch walks the pipeline and both lists of a branch as it cannot be known
+// which would be executed.
+func (a *auditor) branch(n *parse.BranchNode, rebindsDot bool) {
+	a.pipe(n.Pipe)
+
+	dotRebound := a.dotRebound
+	a.dotRebound = dotRebound || rebindsDot
+	a.node(n.List)
+	a.dotRebound = dotRebound
+
+	a.node(n.ElseList)
+}
+
+// pipe records the secret calls of pipe and returns its result as shown in a
+// reference.
+func (a *auditor) pipe(pipe *parse.PipeNode) string {
+	if pipe == nil {
+		return ""
+	}
+	var result *string
+	for _, cmd := range pipe.Cmds {
+		s := a.command(cmd, result)
+		result = &s
+	}
+	if result == nil {
+		return ""
+	}
+	return *result
+}
+
+// command records the secret calls of cmd whose final argument is piped, if
+// not nil, and returns its result as shown in a reference.
+func (a *auditor) command(cmd *parse.CommandNode, piped *string) string {
+	if len(cmd.Args) == 0 {
+		return ""
+	}
+
+	args := make([]any, 0, len(cmd.Args))
+	for _, arg := range cmd.Args[1:] {
+		args = append(args, a.arg(arg))
+	}
+	if piped != nil {
+		args = append(args, *piped)
+	}
+
+	identifier, ok := cmd.Args[0].(*parse.IdentifierNode)
+	if !ok {
+		return a.arg(cmd.Args[0])
+	}
+	return a.call(identifier.Ident, args, cmd.String())
+}
+
+// call records the call if name is a secret function and returns its result
+// as shown in a reference.
+func (a *auditor) call(name string, args []any, text string) string {
+	if provider, ok := a.providers[name]; ok {
+		a.calls = append(a.calls, secretCall{args: args, name: name, path: a.path, provider: provider})
+		return prefetchMarker
+	}
+	for _, arg := range args {
+		if s, ok := arg.(string); ok && strings.Contains(s, prefetchMarker) {
+			return prefetchMarker
+		}
+	}
+	return text
+}
+
+// arg records the secret calls of arg and returns it as shown in a reference.
+func (a *auditor) arg(arg parse.Node) string {
+	switch n := arg.(type) {
+	case *parse.StringNode:
+		return n.Text
+	case *parse.NumberNode:
+		return n.Text
+	case *parse.BoolNode:
+		return strconv.FormatBool(n.True)
+	case *parse.PipeNode:
+		return a.pipe(n)
+	case *parse.IdentifierNode:
+		return a.call(n.Ident, nil, n.String())
+	case *parse.ChainNode:
+		if a.arg(n.Node) == prefetchMarker {
+			return prefetchMarker
+		}
+		return n.String()
+	case *parse.DotNode, *parse.FieldNode:
+		return a.field(arg)
+	}
+	return arg.String()
+}
+
+// field returns the value of a field of the template data, or the field as
+// written if it cannot be resolved.
+func (a *auditor) field(field parse.Node) string {
+	if a.dotRebound {
+		return field.String()
+	}
+	tmpl, err := template.New("field").Option("missingkey=error").Parse("{{ " + field.String() + " }}")
+	if err != nil {
+		return field.String()
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, a.data)
+	if err != nil {
+		return field.String()
+	}
+	return out.String()
+}
+
+// secretReferences returns the distinct references for calls ordered by path.
+func secretReferences(calls []secretCall) []SecretReference {
+	references := make([]SecretReference, 0, len(calls))
+	for _, call := range calls {
+		reference := call.reference()
+		if !slices.Contains(references, reference) {
+			references = append(references, reference)
+		}
+	}
+	slices.SortStableFunc(references, func(a, b SecretReference) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(a.Func, b.Func))
+	})
+	return references
+}
+
+// reference interprets the arguments of the call. All secret functions take
+// the id of the entry as their first argument (after the provider for the
+// generic secret function), followed by the field(s), other than the *Format
+// functions which take a format string first.
+func (c secretCall) reference() SecretReference {
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = strings.ReplaceAll(fmt.Sprint(arg), prefetchMarker, "<secret>")
+	}
+
+	reference := SecretReference{Func: c.name, Path: c.path, Provider: c.provider}
+	if reference.Provider == "" && c.name == "secret" && len(args) > 0 {
+		reference.Provider = args[0]
+		args = args[1:]
+	}
+	if reference.Provider == "" {
+		reference.Provider = c.name
+	}
+
+	if len(args) > 0 {
+		reference.ID = args[0]
+		fields := args[1:]
+		if strings.HasSuffix(c.name, "Format") && len(fields) > 0 {
+			fields = fields[1:]
+		}
+		reference.Field = strings.Join(fields, ",")
+	}
+	return reference
+}
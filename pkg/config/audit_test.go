@@ -0,0 +1,163 @@
+package config_test
+
+import (
+	"slices"
+	"testing"
+	"text/template"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSecretAudit(t *testing.T) {
+	type Config struct {
+		DSN      string `yaml:"dsn"`
+		Name     string `yaml:"name"`
+		Password string `yaml:"password"`
+		Token    string `yaml:"token"`
+		Username string `yaml:"username"`
+	}
+
+	registry := secrets.NewRegistry()
+	registry.Register("bitwarden", auditProvider{t: t, funcs: []string{"bitwarden", "bitwardenFormat"}})
+	registry.Register("lastpass", auditProvider{t: t, funcs: []string{"lastpass"}})
+	unmarshal := config.YamlValueTemplateUnmarshalContext[Config](
+		config.NewTemplate(
+			template.FuncMap{
+				"upper": func(string) string {
+					t.Fatalf("function executed during audit")
+					return ""
+				},
+			},
+			config.WithRegistry(registry)))
+
+	sources := config.Sources[Config]{
+		config.RawSource[Config]{
+			Data: []byte(`
+dsn: '{{ bitwardenFormat "db" "%s:%s" "username" "password" }}'
+name: '{{ upper "name" }}'
+password: '{{ bitwarden (lastpass "bw-id") }}'
+token: '{{ if .Env.NO_SUCH_VAR }}{{ secret "vault" "secret/app" "token" }}{{ else }}{{ .Env.USER | lastpass }}{{ end }}'
+username: '{{ secret "keyring" "user" }}'
+`),
+			UnmarshalContext: unmarshal,
+		},
+		config.RawSource[Config]{Data: []byte(`username: plain`)},
+	}
+
+	expected := []config.SecretReference{
+		{Field: "username,password", Func: "bitwardenFormat", ID: "db", Path: "/dsn", Provider: "bitwarden"},
+		{Func: "bitwarden", ID: "<secret>", Path: "/password", Provider: "bitwarden"},
+		{Func: "lastpass", ID: "bw-id", Path: "/password", Provider: "lastpass"},
+		{Func: "lastpass", ID: "auditor", Path: "/token", Provider: "lastpass"},
+		{Field: "token", Func: "secret", ID: "secret/app", Path: "/token", Provider: "vault"},
+	}
+
+	t.Run("eager", func(t *testing.T) {
+		t.Setenv("USER", "auditor")
+		var references []config.SecretReference
+		var cfg Config
+		err := sources.Load(&cfg, config.WithSecretAudit(&references))
+		require.NoError(t, err)
+		require.Equal(t, Config{Username: "plain"}, cfg)
+		require.Equal(t,
+			append(slices.Clone(expected),
+				config.SecretReference{Func: "secret", ID: "user", Path: "/username", Provider: "keyring"}),
+			references)
+	})
+
+	t.Run("deferred", func(t *testing.T) {
+		t.Setenv("USER", "auditor")
+		var references []config.SecretReference
+		var cfg Config
+		err := sources.Load(&cfg, config.WithDeferredTemplates(), config.WithSecretAudit(&references))
+		require.NoError(t, err)
+		require.Equal(t, "plain", cfg.Username)
+		require.Equal(t, expected, references)
+	})
+
+	t.Run("typed fields", func(t *testing.T) {
+		// templates are not unmarshaled into fields that cannot hold them and
+		// the secret functions of DefaultFuncMap are recognised by name
+		type Config struct {
+			Host string `yaml:"host"`
+			Port int    `yaml:"port"`
+		}
+		var references []config.SecretReference
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{
+				Data: []byte(`
+host: db
+port: '{{ vaultField "secret/db" "port" }}'
+`),
+				UnmarshalContext: config.YamlValueTemplateUnmarshalContext[Config](
+					config.NewTemplate(template.FuncMap{
+						"vaultField": func(string, string) (string, error) {
+							t.Fatalf("secret fetched during audit")
+							return "", nil
+						},
+					})),
+			},
+			config.RawSource[Config]{Data: []byte(`port: 5432`)},
+		}.Load(&cfg, config.WithSecretAudit(&references))
+		require.NoError(t, err)
+		require.Equal(t, Config{Port: 5432}, cfg)
+		require.Equal(t,
+			[]config.SecretReference{{Field: "port", Func: "vaultField", ID: "secret/db", Path: "/port", Provider: "vault"}},
+			references)
+	})
+
+	t.Run("not a template", func(t *testing.T) {
+		var references []config.SecretReference
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{
+				Data:             []byte(`name: '{{ upper "name" }}'`),
+				UnmarshalContext: config.YamlValueTemplateUnmarshalContext[Config](passthroughExecutor{}),
+			},
+		}.Load(&cfg, config.WithSecretAudit(&references))
+		require.ErrorContains(t, err, "cannot report its secret calls")
+	})
+}
+
+// auditProvider is a secrets.FuncProvider whose functions fail the test if
+// they are called.
+type auditProvider struct {
+	funcs []string
+	t     *testing.T
+}
+
+func (p auditProvider) AddFuncs(funcs map[string]any) {
+	for _, name := range p.funcs {
+		funcs[name] = func(args ...string) (string, error) {
+			p.t.Fatalf("secret fetched during audit: %s %v", name, args)
+			return "", nil
+		}
+	}
+}
+
+func (p auditProvider) Check() error {
+	return nil
+}
+
+func (p auditProvider) Get(id string) (string, error) {
+	return p.GetField(id, "")
+}
+
+func (p auditProvider) GetField(id string, field string) (string, error) {
+	p.t.Fatalf("secret fetched during audit: %s %s", id, field)
+	return "", nil
+}
+
+func (p auditProvider) List() ([]string, error) {
+	return nil, secrets.ErrNotSupported
+}
+
+// passthroughExecutor is an Executor that returns values unmodified.
+type passthroughExecutor struct{}
+
+func (passthroughExecutor) Execute(_ string, value any) (any, error) {
+	return value, nil
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,25 +19,129 @@ type SourceLoader[T any] interface {
 	String() string
 }
 
+// ContextSourceLoader is a SourceLoader that accepts a ctx. Sources.Load calls
+// LoadContext rather than Load for those that implement it, passing a ctx that
+// carries the state of the load (ie: the pending WithDeferredTemplates values,
+// the WithSecretPaths paths, the per-load secret cache) and the source path
+// (see SourcePath). The ctx must be passed on to the UnmarshalContext function
+// of the source for the load options to take effect.
+type ContextSourceLoader[T any] interface {
+	SourceLoader[T]
+	LoadContext(ctx context.Context, cfg *T) error
+}
+
 // Sources is an aggregate of SourceLoaders that is used to load and merge
 // configuration.
 type Sources[T any] []SourceLoader[T]
 
+// LoadOption configures the behavior of Sources.Load.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	cacheOptions   secretCacheOptions
+	deferTemplates bool
+	interpolate    bool
+	secretAudit    *[]SecretReference
+	secretPaths    *[]string
+}
+
+// WithInterpolation will resolve `${path.to.key}` and `${env:VAR:-default}`
+// references after all sources have been merged. See Interpolate for details.
+func WithInterpolation() LoadOption {
+	return func(o *loadOptions) {
+		o.interpolate = true
+	}
+}
+
 // Load will load the configuration from all the Sources. Each SourceLoader will
 // load its values over the top of the previous loaders directly into the
 // supplied cfg object.
-func (s Sources[T]) Load(cfg *T) error {
+func (s Sources[T]) Load(cfg *T, opts ...LoadOption) error {
+	var options loadOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	load := &loadContext{cacheOptions: options.cacheOptions}
+	if options.deferTemplates {
+		load.deferred = map[string]deferredValue{}
+	}
+	if options.secretPaths != nil {
+		load.secrets = map[string]bool{}
+		load.secretValues = map[string]any{}
+	}
+	if options.secretAudit != nil {
+		load.audit = &[]secretCall{}
+	}
+
 	start := time.Now()
+	ctx := withSourceContext(context.Background(), &sourceContext{load: load})
 	for _, src := range s {
-		err := src.Load(cfg)
+		err := loadSource(ctx, src, cfg)
 		if err != nil {
 			return fmt.Errorf("load: %w", err)
 		}
+		err = load.recordSecretValues(cfg)
+		if err != nil {
+			return fmt.Errorf("load secret paths: %w", err)
+		}
+	}
+
+	if options.deferTemplates {
+		collector := &secretCollector{
+			lookup: func(name string, value any) Executor {
+				return pendingExecutorFor(load.deferred, name, value)
+			},
+		}
+		err := Walk(collector, cfg)
+		if err != nil {
+			return fmt.Errorf("load collect secrets: %w", err)
+		}
+		err = collector.prefetch()
+		if err != nil {
+			return fmt.Errorf("load deferred templates: %w", err)
+		}
+
+		err = Walk(pendingExecutor{pending: load.deferred}, cfg)
+		if err != nil {
+			return fmt.Errorf("load deferred templates: %w", err)
+		}
+		err = load.recordSecretValues(cfg)
+		if err != nil {
+			return fmt.Errorf("load secret paths: %w", err)
+		}
+	}
+
+	if options.interpolate {
+		err := interpolateConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("load interpolate: %w", err)
+		}
+	}
+
+	if options.secretAudit != nil {
+		*options.secretAudit = secretReferences(*load.audit)
+	}
+
+	if options.secretPaths != nil {
+		paths, err := load.secretValuePaths(cfg)
+		if err != nil {
+			return fmt.Errorf("load secret paths: %w", err)
+		}
+		*options.secretPaths = paths
 	}
 	log.Logger.Debug().Dur("duration", time.Since(start)).Msg("load complete")
 	return nil
 }
 
+// loadSource loads src passing it ctx if it is a ContextSourceLoader.
+func loadSource[T any](ctx context.Context, src SourceLoader[T], cfg *T) error {
+	if c, ok := src.(ContextSourceLoader[T]); ok {
+		return c.LoadContext(ctx, cfg) //nolint:wrapcheck // wrapped by Load
+	}
+	return src.Load(cfg) //nolint:wrapcheck // wrapped by Load
+}
+
 func normalizePath(path string) string {
 	if strings.HasPrefix(path, "~/") {
 		homeDir, err := os.UserHomeDir()
@@ -49,12 +154,27 @@ func normalizePath(path string) string {
 	return path
 }
 
-func unmarshal[T any](b []byte, cfg *T, unmarshal func(b []byte, cfg *T) error) error {
-	if unmarshal == nil {
-		unmarshal = YamlUnmarshal[T]()
+func unmarshal[T any](
+	ctx context.Context,
+	path string,
+	b []byte,
+	cfg *T,
+	plain func(b []byte, cfg *T) error,
+	unmarshal func(ctx context.Context, b []byte, cfg *T) error,
+) error {
+	switch {
+	case unmarshal != nil:
+	case plain != nil:
+		unmarshal = withoutContext(plain)
+	default:
+		unmarshal = ExtensionUnmarshal[T](nil)
 	}
 
-	err := unmarshal(b, cfg)
+	source := &sourceContext{
+		load: lookupSourceContext(ctx).load,
+		path: path,
+	}
+	err := unmarshal(withSourceContext(ctx, source), b, cfg)
 	if err != nil {
 		return fmt.Errorf("unmarshal: %w", err)
 	}
@@ -71,3 +191,10 @@ func YamlUnmarshal[T any]() func(b []byte, cfg *T) error {
 		return nil
 	}
 }
+
+// withoutContext adapts an Unmarshal function that does not take a ctx.
+func withoutContext[T any](unmarshal func(b []byte, cfg *T) error) func(ctx context.Context, b []byte, cfg *T) error {
+	return func(_ context.Context, b []byte, cfg *T) error {
+		return unmarshal(b, cfg)
+	}
+}
@@ -2,6 +2,7 @@
 package config_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -234,3 +235,24 @@ func TestLoad(t *testing.T) {
 		}.Test(t, cfg{Foo: "baz", Hip: "hop"}, actual)
 	})
 }
+
+func TestSourcePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`a: b`), 0o600))
+
+	var paths []string
+	record := func(ctx context.Context, _ []byte, _ *map[string]any) error {
+		paths = append(paths, config.SourcePath(ctx))
+		return nil
+	}
+
+	var cfg map[string]any
+	err := config.Sources[map[string]any]{
+		config.FileSource[map[string]any]{Path: path, UnmarshalContext: record},
+		config.RawSource[map[string]any]{Data: []byte(`a: b`), UnmarshalContext: record},
+	}.Load(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, []string{path, ""}, paths)
+	require.Empty(t, config.SourcePath(context.Background()))
+}
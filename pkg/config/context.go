@@ -0,0 +1,81 @@
+package config
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// sourceContextKey is the context key for the sourceContext passed to
+// ContextSourceLoaders and UnmarshalContext functions.
+type sourceContextKey struct{}
+
+// sourceContext holds details about the source currently being unmarshaled.
+type sourceContext struct {
+	load *loadContext
+	path string
+}
+
+// loadContext holds state that spans all of the sources of a Sources.Load.
+type loadContext struct {
+	// deferred holds the values whose templates should be executed once all
+	// sources have been merged, keyed by their path. It is nil unless
+	// WithDeferredTemplates was specified.
+	deferred map[string]deferredValue
+	// secrets holds the paths of the values rendered by templates calling
+	// secret functions that have yet to be recorded in secretValues. It is
+	// nil unless WithSecretPaths was specified.
+	secrets map[string]bool
+	// secretValues holds the value of each of the secrets in the config once
+	// the source that rendered it was loaded, keyed by their path.
+	secretValues map[string]any
+	// audit holds the secret calls recorded rather than executed. It is nil
+	// unless WithSecretAudit was specified.
+	audit *[]secretCall
+	// cacheOptions configure the secret cache of the load (see
+	// WithSecretCache).
+	cacheOptions secretCacheOptions
+
+	cache     *secrets.Cache
+	cacheOnce sync.Once
+}
+
+// secretCacheOptions are the options of the secret cache of a load.
+type secretCacheOptions = []secrets.CacheOption
+
+// secretCache returns the cache memoizing the secret lookups of the load. A
+// nil loadContext (ie: an unmarshal function called outside of a load) gets a
+// new cache on each call.
+func (l *loadContext) secretCache() *secrets.Cache {
+	if l == nil {
+		return secrets.NewCache()
+	}
+	l.cacheOnce.Do(func() {
+		l.cache = secrets.NewCache(l.cacheOptions...)
+	})
+	return l.cache
+}
+
+// SourcePath returns the path of the file being unmarshaled from the ctx
+// passed to an UnmarshalContext function. It is empty for sources that are not backed
+// by a file.
+func SourcePath(ctx context.Context) string {
+	return lookupSourceContext(ctx).path
+}
+
+func lookupSourceContext(ctx context.Context) *sourceContext {
+	if ctx == nil {
+		return &sourceContext{}
+	}
+	source, ok := ctx.Value(sourceContextKey{}).(*sourceContext)
+	if !ok {
+		return &sourceContext{}
+	}
+	return source
+}
+
+// withSourceContext returns a copy of ctx carrying source.
+func withSourceContext(ctx context.Context, source *sourceContext) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, source)
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/credentials"
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// CredentialsDirSource is a directory of credentials to load, such as the one
+// systemd provides to services using `LoadCredential=` (ie:
+// $CREDENTIALS_DIRECTORY) or the one secrets are mounted at in containers (ie:
+// /run/secrets). The name of each file is a dot separated key path (ie:
+// `database.password`) and its content, less any trailing newline, is the
+// string value for that key.
+type CredentialsDirSource[T any] struct {
+	// Path is the directory containing the credentials. If not specified
+	// $CREDENTIALS_DIRECTORY will be used.
+	Path string
+	// Unmarshal is the function to unmarshal the (yaml encoded) credentials
+	// into the cfg object. If not specified ExtensionUnmarshal(YamlUnmarshal)
+	// will be used, which unmarshals them as yaml as they have no extension.
+	Unmarshal func(b []byte, cfg *T) error
+	// UnmarshalContext, if specified, is used in place of Unmarshal and is
+	// passed the ctx of LoadContext (see ContextSourceLoader).
+	UnmarshalContext func(ctx context.Context, b []byte, cfg *T) error
+}
+
+func (s CredentialsDirSource[T]) Load(cfg *T) error {
+	return s.LoadContext(context.Background(), cfg)
+}
+
+func (s CredentialsDirSource[T]) LoadContext(ctx context.Context, cfg *T) error {
+	dir := s.Path
+	if dir == "" {
+		dir = os.Getenv("CREDENTIALS_DIRECTORY")
+	}
+	if dir == "" {
+		log.Logger.Debug().Msg("no credentials directory")
+		return nil
+	}
+	dir = normalizePath(dir)
+
+	listing, err := os.ReadDir(dir)
+	if err != nil {
+		log.Logger.Debug().Str("dir", dir).Msg("no credentials found")
+		//nolint: nilerr // intentional ignore error
+		return nil
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	files := zerolog.Arr()
+	for _, entry := range listing {
+		name := entry.Name()
+		// hidden files include the ..data links kubernetes uses to update
+		// mounted secrets atomically
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		file := filepath.Join(dir, name)
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("stat: %w", err)
+		}
+		if info.IsDir() {
+			log.Logger.Debug().Str("dir", dir).Str("subdir", name).Msg("skipping subdir")
+			continue
+		}
+
+		value, err := credentials.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("load from credentials dir: %w", err)
+		}
+
+		files.Str(file)
+		setNode(root, strings.Split(name, "."), value)
+	}
+
+	b, err := yaml.Marshal(root)
+	if err != nil {
+		return fmt.Errorf("load from credentials dir marshal: %w", err)
+	}
+
+	err = unmarshal(ctx, "", b, cfg, s.Unmarshal, s.UnmarshalContext)
+	if err != nil {
+		return fmt.Errorf("load from credentials dir: %w", err)
+	}
+
+	log.Logger.Debug().Str("dir", dir).Array("files", files).Msg("loaded credentialsdirsource config")
+	return nil
+}
+
+func (s CredentialsDirSource[T]) String() string {
+	return fmt.Sprintf("credentialsdirsource:%s", s.Path)
+}
+
+// setNode sets the value at the key path in the mapping node, creating the
+// intermediate mappings as necessary. Values are always strings so that
+// credentials such as `0123` or `no` are not reinterpreted.
+func setNode(node *yaml.Node, path []string, value string) {
+	for i := 0; i < len(node.Content); i += 2 {
+		if node.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) > 1 && node.Content[i+1].Kind == yaml.MappingNode {
+			setNode(node.Content[i+1], path[1:], value)
+			return
+		}
+		node.Content = slices.Delete(node.Content, i, i+2)
+		break
+	}
+
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}
+	if len(path) == 1 {
+		node.Content = append(node.Content, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	node.Content = append(node.Content, key, child)
+	setNode(child, path[1:], value)
+}
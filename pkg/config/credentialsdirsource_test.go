@@ -0,0 +1,75 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsDirSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	write("database.password", "pass\n")
+	write("database.port", "0123")
+	write("api-token", "tok")
+	write(".hidden", "ignored")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+
+	t.Run("source", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", dir)
+
+		type Config struct {
+			APIToken string `yaml:"api-token"`
+			Database struct {
+				Host     string `yaml:"host"`
+				Password string `yaml:"password"`
+				Port     string `yaml:"port"`
+			} `yaml:"database"`
+		}
+
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{Data: []byte(`{database: {host: db.example.org}}`)},
+			config.CredentialsDirSource[Config]{},
+		}.Load(&cfg)
+		require.NoError(t, err)
+
+		var expected Config
+		expected.APIToken = "tok"
+		expected.Database.Host = "db.example.org"
+		expected.Database.Password = "pass"
+		expected.Database.Port = "0123"
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("missing dir", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", "")
+
+		var cfg map[string]any
+		err := config.CredentialsDirSource[map[string]any]{}.Load(&cfg)
+		require.NoError(t, err)
+		require.Nil(t, cfg)
+	})
+
+	t.Run("funcs", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", dir)
+		tmpl := config.NewTemplate(config.DefaultFuncMap())
+
+		actual, err := tmpl.Execute("/", `{{ credential "database.password" }}`)
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+
+		actual, err = tmpl.Execute("/", `{{ secret "credentials" "api-token" }}`)
+		require.NoError(t, err)
+		require.Equal(t, "tok", actual)
+
+		actual, err = tmpl.Execute("/", `{{ secretFile "`+filepath.Join(dir, "database.port")+`" | raw }}`)
+		require.NoError(t, err)
+		require.Equal(t, "0123", actual)
+	})
+}
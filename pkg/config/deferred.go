@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// WithDeferredTemplates will defer the execution of values templated by
+// YamlValueTemplateUnmarshalContext until all sources have been merged. Only
+// the templates for values that were not overridden by a later source will be
+// executed, so secrets for overridden values are never fetched. Each value is
+// still executed with the executor (and template data) of the file it came
+// from.
+//
+// As templates are merged before they are executed, the templated values must
+// be unmarshalable into their field in T as a string (ie: a string or any
+// typed field). Keys templated using WithKeys are executed when the file is
+// loaded as they are needed to merge.
+func WithDeferredTemplates() LoadOption {
+	return func(o *loadOptions) {
+		o.deferTemplates = true
+	}
+}
+
+type deferredValue struct {
+	executor Executor
+	value    any
+}
+
+// deferringExecutor records each string value along with the executor that
+// should eventually execute it and returns the value unmodified.
+type deferringExecutor struct {
+	executor Executor
+	pending  map[string]deferredValue
+}
+
+func (d deferringExecutor) Execute(name string, value any) (any, error) {
+	if _, ok := value.(string); ok {
+		d.pending[name] = deferredValue{executor: d.executor, value: value}
+	}
+	return value, nil
+}
+
+// pendingExecutor executes the deferred values that still hold the value that
+// was recorded, that is the values that were not overridden by a later source.
+type pendingExecutor struct {
+	pending map[string]deferredValue
+}
+
+func (p pendingExecutor) Execute(name string, value any) (any, error) {
+	executor := pendingExecutorFor(p.pending, name, value)
+	if executor == nil {
+		return value, nil
+	}
+
+	v, err := executor.Execute(name, value)
+	if err != nil {
+		return nil, fmt.Errorf("deferred: %w", err)
+	}
+	return v, nil
+}
+
+// pendingExecutorFor returns the executor recorded for name if value has not
+// been overridden, nil otherwise.
+func pendingExecutorFor(pending map[string]deferredValue, name string, value any) Executor {
+	deferred, ok := pending[name]
+	if !ok || !sameValue(deferred.value, value) {
+		return nil
+	}
+	return deferred.executor
+}
+
+// sameValue compares a value recorded from the generic yaml map to the value
+// found in the merged config which may have been converted to a different
+// string type.
+func sameValue(recorded any, value any) bool {
+	if reflect.DeepEqual(recorded, value) {
+		return true
+	}
+	rv := reflect.ValueOf(value)
+	s, ok := recorded.(string)
+	return ok && rv.Kind() == reflect.String && rv.String() == s
+}
@@ -0,0 +1,114 @@
+//nolint:goconst // explicit strings have explanatory value in tests
+package config_test
+
+import (
+	"fmt"
+	"testing"
+	"text/template"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeferredTemplates(t *testing.T) {
+	type Config struct {
+		Password string `yaml:"password"`
+		Token    string `yaml:"token"`
+		Username string `yaml:"username"`
+	}
+
+	load := func(t *testing.T, opts ...config.LoadOption) (Config, []string) {
+		var fetched []string
+		unmarshal := config.YamlValueTemplateUnmarshalContext[Config](
+			config.NewTemplate(template.FuncMap{
+				"secret": func(id string) string {
+					fetched = append(fetched, id)
+					return fmt.Sprintf("secret-%s", id)
+				},
+			}))
+
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{
+				Data: []byte(`
+password: '{{ secret "system-password" }}'
+token: '{{ secret "system-token" }}'
+username: '{{ secret "system-username" }}'
+`),
+				UnmarshalContext: unmarshal,
+			},
+			// plain override
+			config.RawSource[Config]{Data: []byte(`password: plain`)},
+			// templated override
+			config.RawSource[Config]{
+				Data:             []byte(`token: '{{ secret "user-token" }}'`),
+				UnmarshalContext: unmarshal,
+			},
+		}.Load(&cfg, opts...)
+		require.NoError(t, err)
+		return cfg, fetched
+	}
+
+	expected := Config{
+		Password: "plain",
+		Token:    "secret-user-token",
+		Username: "secret-system-username",
+	}
+
+	t.Run("eager", func(t *testing.T) {
+		cfg, fetched := load(t)
+		require.Equal(t, expected, cfg)
+		require.ElementsMatch(t,
+			[]string{"system-password", "system-token", "system-username", "user-token"},
+			fetched)
+	})
+
+	t.Run("deferred", func(t *testing.T) {
+		cfg, fetched := load(t, config.WithDeferredTemplates())
+		require.Equal(t, expected, cfg)
+		require.ElementsMatch(t, []string{"system-username", "user-token"}, fetched)
+	})
+
+	t.Run("deferred map", func(t *testing.T) {
+		var fetched []string
+		unmarshal := config.YamlValueTemplateUnmarshalContext[map[any]any](
+			config.NewTemplate(template.FuncMap{
+				"secret": func(id string) string {
+					fetched = append(fetched, id)
+					return fmt.Sprintf("secret-%s", id)
+				},
+			}),
+			config.WithKeys())
+
+		var cfg map[any]any
+		err := config.Sources[map[any]any]{
+			config.RawSource[map[any]any]{
+				Data: []byte(`
+creds:
+  '{{ "db" }}':
+    password: '{{ secret "system" }}'
+`),
+				UnmarshalContext: unmarshal,
+			},
+			config.RawSource[map[any]any]{
+				Data: []byte(`
+creds:
+  db:
+    password: '{{ secret "user" }}'
+`),
+				UnmarshalContext: unmarshal,
+			},
+		}.Load(&cfg, config.WithDeferredTemplates())
+		require.NoError(t, err)
+		require.Equal(t,
+			map[any]any{
+				"creds": map[string]any{
+					"db": map[string]any{
+						"password": "secret-user",
+					},
+				},
+			},
+			cfg)
+		require.Equal(t, []string{"user"}, fetched)
+	})
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,11 +16,19 @@ import (
 type DirSource[T any] struct {
 	Path string
 	// Unmarshal is the function to unmarshal the data from each file into the
-	// cfg object. If not specified YamlUnmarshal will be used.
+	// cfg object. If not specified ExtensionUnmarshal(YamlUnmarshal) will be
+	// used, decrypting encrypted files before unmarshaling them as yaml.
 	Unmarshal func(b []byte, cfg *T) error
+	// UnmarshalContext, if specified, is used in place of Unmarshal and is
+	// passed the ctx of LoadContext (see ContextSourceLoader).
+	UnmarshalContext func(ctx context.Context, b []byte, cfg *T) error
 }
 
 func (s DirSource[T]) Load(cfg *T) error {
+	return s.LoadContext(context.Background(), cfg)
+}
+
+func (s DirSource[T]) LoadContext(ctx context.Context, cfg *T) error {
 	dir := normalizePath(s.Path)
 	listing, err := os.ReadDir(dir)
 	if err != nil {
@@ -68,7 +77,7 @@ func (s DirSource[T]) Load(cfg *T) error {
 		}
 
 		files.Str(file)
-		err = unmarshal(b, cfg, s.Unmarshal)
+		err = unmarshal(ctx, file, b, cfg, s.Unmarshal, s.UnmarshalContext)
 		if err != nil {
 			return fmt.Errorf("load from dir: %w", err)
 		}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// ExtensionUnmarshal returns an Unmarshal function that selects how to load a
+// file based on its extension. Files with the extension of an encryption
+// format are decrypted, then unmarshaled based on their remaining extension
+// (ie: secrets.yml.age is decrypted using AgeDecrypt, then unmarshaled as
+// secrets.yml). Yaml and json files (.yaml, .yml or .json) whose content is
+// sops encrypted are decrypted using SopsDecrypt. All other files are
+// unmarshaled using unmarshal (YamlUnmarshal if nil). This is the default for
+// all of the sources, those not backed by a file are unmarshaled using
+// unmarshal.
+//
+// Supported extensions are:
+//
+//   - .age: decrypted using AgeDecrypt with AgeIdentities
+//   - .gpg: decrypted using GpgDecrypt
+func ExtensionUnmarshal[T any](unmarshal func(ctx context.Context, b []byte, cfg *T) error) func(ctx context.Context, b []byte, cfg *T) error {
+	if unmarshal == nil {
+		unmarshal = withoutContext(YamlUnmarshal[T]())
+	}
+	return func(ctx context.Context, b []byte, cfg *T) error {
+		return extensionUnmarshal(ctx, SourcePath(ctx), b, cfg, unmarshal)
+	}
+}
+
+func extensionUnmarshal[T any](
+	ctx context.Context,
+	path string,
+	b []byte,
+	cfg *T,
+	unmarshal func(ctx context.Context, b []byte, cfg *T) error,
+) error {
+	ext := filepath.Ext(path)
+	remaining := strings.TrimSuffix(path, ext)
+
+	switch ext {
+	case ".age":
+		decrypted, err := ageDecrypt(b, nil)
+		if err != nil {
+			return err
+		}
+		return extensionUnmarshal(ctx, remaining, decrypted, cfg, unmarshal)
+	case ".gpg":
+		decrypted, err := gpgDecrypt(b)
+		if err != nil {
+			return err
+		}
+		return extensionUnmarshal(ctx, remaining, decrypted, cfg, unmarshal)
+	}
+	if isSops(path, b) {
+		return SopsDecrypt(unmarshal)(ctx, b, cfg)
+	}
+	return unmarshal(ctx, b, cfg)
+}
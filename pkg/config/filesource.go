@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -11,19 +12,28 @@ import (
 type FileSource[T any] struct {
 	Path string
 	// Unmarshal is the function to unmarshal the data from the file into the
-	// cfg object. If not specified YamlUnmarshal will be used.
+	// cfg object. If not specified ExtensionUnmarshal(YamlUnmarshal) will be
+	// used, decrypting encrypted files before unmarshaling them as yaml.
 	Unmarshal func(b []byte, cfg *T) error
+	// UnmarshalContext, if specified, is used in place of Unmarshal and is
+	// passed the ctx of LoadContext (see ContextSourceLoader).
+	UnmarshalContext func(ctx context.Context, b []byte, cfg *T) error
 }
 
 func (s FileSource[T]) Load(cfg *T) error {
-	b, err := os.ReadFile(normalizePath(s.Path))
+	return s.LoadContext(context.Background(), cfg)
+}
+
+func (s FileSource[T]) LoadContext(ctx context.Context, cfg *T) error {
+	path := normalizePath(s.Path)
+	b, err := os.ReadFile(path)
 	if err != nil {
 		log.Logger.Debug().Str("file", s.Path).Msg("config not found")
 		//nolint: nilerr // intentional ignore error
 		return nil
 	}
 
-	err = unmarshal(b, cfg, s.Unmarshal)
+	err = unmarshal(ctx, path, b, cfg, s.Unmarshal, s.UnmarshalContext)
 	if err != nil {
 		return fmt.Errorf("load from file: %w", err)
 	}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GpgDecrypt returns an Unmarshal function that decrypts gpg encrypted data
+// (binary or armored) using the local gpg binary before passing it to
+// unmarshal (YamlUnmarshal if nil). gpg uses $GNUPGHOME and the running
+// gpg-agent as usual, so a passphrase protected key must either be unlocked
+// in the agent already or the agent must be able to prompt using pinentry.
+func GpgDecrypt[T any](unmarshal func(ctx context.Context, b []byte, cfg *T) error) func(ctx context.Context, b []byte, cfg *T) error {
+	if unmarshal == nil {
+		unmarshal = withoutContext(YamlUnmarshal[T]())
+	}
+	return func(ctx context.Context, b []byte, cfg *T) error {
+		decrypted, err := gpgDecrypt(b)
+		if err != nil {
+			return err
+		}
+		return unmarshal(ctx, decrypted, cfg)
+	}
+}
+
+// gpgDecrypt decrypts b using gpg. It is not run with --quiet as the reason
+// the secret key could not be used is only reported as additional output.
+func gpgDecrypt(b []byte) ([]byte, error) {
+	cmd := exec.Command("gpg", "--batch", "--decrypt")
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if err != nil {
+		errStr := strings.ToLower(stderr.String())
+		// when the agent has to prompt for the passphrase but pinentry cannot
+		// be started (ie: no tty or display) gpg reports one of these
+		for _, locked := range []string{
+			"inappropriate ioctl for device",
+			"no passphrase given",
+			"no pinentry",
+			"operation cancelled",
+			"unknown system error",
+		} {
+			if strings.Contains(errStr, locked) {
+				return nil, errors.New("gpg agent could not unlock the secret key, unlock it (ie: decrypt any file interactively) and try again")
+			}
+		}
+		if strings.Contains(errStr, "no secret key") {
+			return nil, errors.New("gpg secret key not available, check GNUPGHOME and try again")
+		}
+		return nil, fmt.Errorf("run gpg (%s): %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+// gnupgHome sets GNUPGHOME to a new home containing a key for
+// config@example.org protected by passphrase (if not empty) and returns a
+// function to run gpg in it.
+func gnupgHome(t *testing.T, passphrase string) func(stdin []byte, args ...string) []byte {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+
+	// t.TempDir can exceed the max length of the gpg-agent socket path
+	home, err := os.MkdirTemp("", "gnupg")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+		_ = os.RemoveAll(home)
+	})
+	t.Setenv("GNUPGHOME", home)
+	// ensure the agent can never prompt for the passphrase
+	require.NoError(t, os.WriteFile(filepath.Join(home, "gpg-agent.conf"), []byte("pinentry-program /nonexistent\n"), 0o600))
+
+	gpg := func(stdin []byte, args ...string) []byte {
+		cmd := exec.Command("gpg", append([]string{"--batch", "--quiet"}, args...)...)
+		cmd.Stdin = bytes.NewReader(stdin)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		require.NoError(t, err, stderr.String())
+		return out
+	}
+	gpg(nil, "--pinentry-mode", "loopback", "--passphrase", passphrase,
+		"--quick-gen-key", "config@example.org", "default", "default", "never")
+	return gpg
+}
+
+func TestGpg(t *testing.T) {
+	type Config struct {
+		Password string `yaml:"password"`
+		Username string `yaml:"username"`
+	}
+
+	t.Run("extension detection", func(t *testing.T) {
+		gpg := gnupgHome(t, "")
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yml"), []byte(`username: user`), 0o600))
+		gpg([]byte(`password: pass`), "--recipient", "config@example.org",
+			"--output", filepath.Join(dir, "b.yml.gpg"), "--encrypt")
+
+		var cfg Config
+		err := config.Sources[Config]{config.DirSource[Config]{Path: dir}}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, Config{Password: "pass", Username: "user"}, cfg)
+	})
+
+	t.Run("armored", func(t *testing.T) {
+		gpg := gnupgHome(t, "")
+		encrypted := gpg([]byte(`password: pass`), "--recipient", "config@example.org", "--armor", "--encrypt")
+
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{Data: encrypted, UnmarshalContext: config.GpgDecrypt[Config](nil)},
+		}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, Config{Password: "pass"}, cfg)
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		gpg := gnupgHome(t, "secret")
+		encrypted := gpg([]byte(`password: pass`), "--recipient", "config@example.org", "--encrypt")
+
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{Data: encrypted, UnmarshalContext: config.GpgDecrypt[Config](nil)},
+		}.Load(&cfg)
+		require.ErrorContains(t, err, "gpg agent could not unlock the secret key")
+	})
+
+	t.Run("sops", func(t *testing.T) {
+		gpg := gnupgHome(t, "")
+		encrypted := sopsEncrypt(t, func(key []byte) map[string]any {
+			return map[string]any{
+				"pgp": []map[string]string{{
+					"enc": string(gpg(key, "--recipient", "config@example.org", "--armor", "--encrypt")),
+					"fp":  "config@example.org",
+				}},
+			}
+		}, `password: pass`)
+
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{Data: encrypted, UnmarshalContext: config.SopsDecrypt[Config](nil)},
+		}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, Config{Password: "pass"}, cfg)
+	})
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInterpolationCycle is returned when references refer back to themselves.
+var ErrInterpolationCycle = errors.New("interpolation cycle")
+
+// Interpolate will replace all `${path.to.key}` and `${env:VAR:-default}`
+// references found in the string values of data. Paths are dot separated keys
+// (or list indexes) relative to the root of data. If a value consists of a
+// single reference, the referenced value is used as is (preserving its type),
+// otherwise the referenced values are formatted into the string. A literal
+// `${` can be written as `$${`. The default of an env reference may itself
+// contain references or braces (ie: `${env:VAR:-{"a": 1}}`).
+//
+// The references are resolved using the yaml representation of data, so keys
+// are named as they are in the config files, and only the string values
+// containing references are replaced.
+func Interpolate(data any) error {
+	var root yaml.Node
+	err := root.Encode(data)
+	if err != nil {
+		return fmt.Errorf("encode for interpolation: %w", err)
+	}
+	return interpolate(data, &root)
+}
+
+// interpolateConfig interpolates cfg using the revealed values of its Secrets.
+func interpolateConfig[T any](cfg *T) error {
+	var root yaml.Node
+	err := root.Encode(RevealSecrets(cfg))
+	if err != nil {
+		return fmt.Errorf("encode for interpolation: %w", err)
+	}
+	return interpolate(cfg, &root)
+}
+
+// interpolate resolves the references in root, then assigns the values that
+// held references back into data.
+func interpolate(data any, root *yaml.Node) error {
+	i := interpolator{
+		active:   map[string]bool{},
+		changed:  map[string]*yaml.Node{},
+		resolved: map[string]*yaml.Node{},
+		root:     root,
+	}
+
+	_, err := i.value([]string{})
+	if err != nil {
+		return err
+	}
+
+	err = Walk(executorFunc(func(name string, value any) (any, error) {
+		node, ok := i.changed[name]
+		if !ok {
+			return value, nil
+		}
+		var v any
+		err := node.Decode(&v)
+		if err != nil {
+			return nil, fmt.Errorf("decode interpolated %s: %w", name, err)
+		}
+		return v, nil
+	}), data)
+	if err != nil {
+		return fmt.Errorf("assign interpolated: %w", err)
+	}
+	return nil
+}
+
+type interpolator struct {
+	active map[string]bool
+	// changed holds the resolved values of the strings containing references,
+	// keyed by their Walk name (ie: /a/b)
+	changed  map[string]*yaml.Node
+	resolved map[string]*yaml.Node
+	root     *yaml.Node
+	stack    []string
+}
+
+func (i *interpolator) value(path []string) (*yaml.Node, error) {
+	key := strings.Join(path, ".")
+	if v, ok := i.resolved[key]; ok {
+		return v, nil
+	}
+	if i.active[key] {
+		chain := i.stack[slices.Index(i.stack, key):]
+		return nil, fmt.Errorf(
+			"%w: %s -> %s",
+			ErrInterpolationCycle,
+			strings.Join(chain, " -> "),
+			key)
+	}
+
+	node, err := lookupPath(i.root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	i.active[key] = true
+	i.stack = append(i.stack, key)
+	defer func() {
+		delete(i.active, key)
+		i.stack = i.stack[:len(i.stack)-1]
+	}()
+
+	v, err := i.resolve(node, path)
+	if err != nil {
+		return nil, err
+	}
+
+	i.resolved[key] = v
+	return v, nil
+}
+
+func (i *interpolator) resolve(node *yaml.Node, path []string) (*yaml.Node, error) {
+	//nolint:exhaustive // aliases are not produced by encoding a value
+	switch node.Kind {
+	case yaml.MappingNode:
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			v, err := i.value(append(path[:len(path):len(path)], node.Content[j].Value))
+			if err != nil {
+				return nil, err
+			}
+			node.Content[j+1] = v
+		}
+		return node, nil
+	case yaml.SequenceNode:
+		for j := range node.Content {
+			v, err := i.value(append(path[:len(path):len(path)], strconv.Itoa(j)))
+			if err != nil {
+				return nil, err
+			}
+			node.Content[j] = v
+		}
+		return node, nil
+	case yaml.ScalarNode:
+		if node.ShortTag() != "!!str" || !strings.Contains(node.Value, "${") {
+			return node, nil
+		}
+		v, err := i.resolveString(node.Value, path)
+		if err != nil {
+			return nil, err
+		}
+		i.changed["/"+strings.Join(path, "/")] = v
+		return v, nil
+	default:
+		return node, nil
+	}
+}
+
+func (i *interpolator) resolveString(str string, path []string) (*yaml.Node, error) {
+	var b strings.Builder
+	rest := str
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		if start > 0 && rest[start-1] == '$' {
+			// `$${` is an escaped literal `${`
+			b.WriteString(rest[:start-1])
+			b.WriteString("${")
+			rest = rest[start+2:]
+			continue
+		}
+
+		end := referenceEnd(rest, start)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated reference in /%s: %s", strings.Join(path, "/"), str)
+		}
+
+		v, err := i.reference(rest[start+2:end], path)
+		if err != nil {
+			return nil, fmt.Errorf("interpolate /%s: %w", strings.Join(path, "/"), err)
+		}
+
+		if len(rest) == len(str) && start == 0 && end == len(str)-1 {
+			// the whole value is a single reference so preserve its type
+			return v, nil
+		}
+
+		if v.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf(
+				"interpolate /%s: cannot embed non scalar %s in string",
+				strings.Join(path, "/"),
+				rest[start:end+1])
+		}
+
+		b.WriteString(rest[:start])
+		if v.ShortTag() != "!!null" {
+			b.WriteString(v.Value)
+		}
+		rest = rest[end+1:]
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: b.String()}, nil
+}
+
+// referenceEnd returns the index of the brace closing the reference starting
+// at start, allowing for nested braces, or -1 if it is not closed.
+func referenceEnd(s string, start int) int {
+	depth := 0
+	for j := start + 1; j < len(s); j++ {
+		switch s[j] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func (i *interpolator) reference(ref string, path []string) (*yaml.Node, error) {
+	if name, ok := strings.CutPrefix(ref, "env:"); ok {
+		name, def, hasDefault := strings.Cut(name, ":-")
+		v, ok := os.LookupEnv(name)
+		if hasDefault && (!ok || v == "") {
+			if strings.Contains(def, "${") {
+				return i.resolveString(def, path)
+			}
+			v = def
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	}
+
+	if ref == "" {
+		return nil, errors.New("empty reference")
+	}
+
+	return i.value(strings.Split(ref, "."))
+}
+
+func lookupPath(node *yaml.Node, path []string) (*yaml.Node, error) {
+	if node.Kind == yaml.DocumentNode && len(node.Content) == 1 {
+		node = node.Content[0]
+	}
+	for n, key := range path {
+		var next *yaml.Node
+		//nolint:exhaustive // only collections have children
+		switch node.Kind {
+		case yaml.MappingNode:
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if node.Content[j].Value == key {
+					next = node.Content[j+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(key)
+			if err == nil && index >= 0 && index < len(node.Content) {
+				next = node.Content[index]
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("undefined reference: %s", strings.Join(path[:n+1], "."))
+		}
+		node = next
+	}
+	return node, nil
+}
@@ -0,0 +1,174 @@
+//nolint:goconst // explicit strings have explanatory value in tests
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestInterpolate(t *testing.T) {
+	test := func(t *testing.T, data string, expected any) {
+		var actual any
+		err := yaml.Unmarshal([]byte(data), &actual)
+		require.NoError(t, err)
+
+		err = config.Interpolate(actual)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	t.Run("simple", func(t *testing.T) {
+		test(t,
+			`
+base_url: https://example.com
+api_url: ${base_url}/api
+`,
+			map[string]any{
+				"base_url": "https://example.com",
+				"api_url":  "https://example.com/api",
+			})
+	})
+
+	t.Run("nested and chained", func(t *testing.T) {
+		test(t,
+			`
+server:
+  host: example.com
+  url: https://${server.host}
+clients:
+- url: ${server.url}/a
+- url: ${clients.0.url}/b
+`,
+			map[string]any{
+				"server": map[string]any{
+					"host": "example.com",
+					"url":  "https://example.com",
+				},
+				"clients": []any{
+					map[string]any{"url": "https://example.com/a"},
+					map[string]any{"url": "https://example.com/a/b"},
+				},
+			})
+	})
+
+	t.Run("preserves type", func(t *testing.T) {
+		test(t,
+			`
+port: 8080
+listen: ${port}
+addr: localhost:${port}
+tags: [a, b]
+alias: ${tags}
+`,
+			map[string]any{
+				"port":   8080,
+				"listen": 8080,
+				"addr":   "localhost:8080",
+				"tags":   []any{"a", "b"},
+				"alias":  []any{"a", "b"},
+			})
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("CONFIGLOADER_TEST_SET", "set")
+		t.Setenv("CONFIGLOADER_TEST_EMPTY", "")
+		test(t,
+			`
+set: ${env:CONFIGLOADER_TEST_SET}
+set_default: ${env:CONFIGLOADER_TEST_SET:-other}
+empty_default: ${env:CONFIGLOADER_TEST_EMPTY:-other}
+unset_default: ${env:CONFIGLOADER_TEST_UNSET:-other}
+unset: x${env:CONFIGLOADER_TEST_UNSET}x
+`,
+			map[string]any{
+				"set":           "set",
+				"set_default":   "set",
+				"empty_default": "other",
+				"unset_default": "other",
+				"unset":         "xx",
+			})
+	})
+
+	t.Run("env default with braces", func(t *testing.T) {
+		test(t,
+			`
+foo: bar
+json: '${env:CONFIGLOADER_TEST_UNSET:-{"a": {"b": 1}}}'
+nested: x${env:CONFIGLOADER_TEST_UNSET:-${foo}}x
+`,
+			map[string]any{
+				"foo":    "bar",
+				"json":   `{"a": {"b": 1}}`,
+				"nested": "xbarx",
+			})
+	})
+
+	t.Run("escape", func(t *testing.T) {
+		test(t,
+			`
+foo: bar
+literal: $${foo}
+mixed: $${foo} is ${foo}
+dollar: $5
+`,
+			map[string]any{
+				"foo":     "bar",
+				"literal": "${foo}",
+				"mixed":   "${foo} is bar",
+				"dollar":  "$5",
+			})
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		var data any
+		err := yaml.Unmarshal([]byte(`
+a: ${b}
+b: x${c}
+c: ${a}
+`), &data)
+		require.NoError(t, err)
+
+		err = config.Interpolate(data)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, config.ErrInterpolationCycle))
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		var data any
+		err := yaml.Unmarshal([]byte(`a: ${b.c}`), &data)
+		require.NoError(t, err)
+
+		err = config.Interpolate(data)
+		require.ErrorContains(t, err, "undefined reference: b")
+	})
+}
+
+func TestLoadWithInterpolation(t *testing.T) {
+	type cfg struct {
+		BaseURL string `yaml:"base_url"`
+		API     struct {
+			URL string `yaml:"url"`
+		} `yaml:"api"`
+		Ignored  string `yaml:"-"`
+		internal string
+	}
+
+	actual := cfg{Ignored: "kept", internal: "kept"}
+	err := config.Sources[cfg]{
+		config.RawSource[cfg]{Data: []byte(`
+base_url: https://example.com
+api:
+  url: ${base_url}/api
+`)},
+		config.RawSource[cfg]{Data: []byte(`base_url: https://example.org`)},
+	}.Load(&actual, config.WithInterpolation())
+	require.NoError(t, err)
+	require.Equal(t, "https://example.org", actual.BaseURL)
+	require.Equal(t, "https://example.org/api", actual.API.URL)
+	require.Equal(t, "kept", actual.Ignored)
+	require.Equal(t, "kept", actual.internal)
+}
@@ -0,0 +1,250 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultPrefetchWorkers is the number of secrets fetched concurrently when
+// WithPrefetch is supplied a non-positive number of workers.
+const DefaultPrefetchWorkers = 8
+
+// prefetchMarker is returned by the recording functions so that calls whose
+// arguments depend on the result of another secret function can be skipped.
+const prefetchMarker = "\x00configloader-prefetch\x00"
+
+// WithPrefetch will fetch the secrets referenced by the values of a file (or,
+// with WithDeferredTemplates, the values remaining after all sources are
+// merged) in parallel before any of them are rendered. Each value is first
+// executed with the named funcs replaced by functions that record their
+// arguments, then each distinct call is made using a pool of workers. The
+// values are then rendered as usual, so the secret functions must be memoized
+// for this to help (as those added by WithRegistry are).
+//
+// If any of the calls fail, the errors are returned (ordered by the path of
+// the first value to make the call) before any value is rendered.
+func WithPrefetch(workers int, funcs ...string) TemplateOption {
+	return func(t *Template) {
+		if workers < 1 {
+			workers = DefaultPrefetchWorkers
+		}
+		t.prefetch = &prefetchOptions{funcs: funcs, workers: workers}
+	}
+}
+
+type prefetchOptions struct {
+	funcs   []string
+	workers int
+}
+
+// callRecorder records the calls to the secret functions of a Template (see
+// secretFuncProviders). It is shared by all copies of the Template.
+type callRecorder struct {
+	// calls made by the current execution of recorder
+	calls []secretCall
+	mu    sync.Mutex
+	// recorder is built on first use so that it sees the functions added by
+	// any option (ie: WithRegistry)
+	recorder func() *Template
+}
+
+func newCallRecorder(t *Template) *callRecorder {
+	r := &callRecorder{}
+	r.recorder = sync.OnceValue(func() *Template {
+		recording := maps.Clone(t.funcMap)
+		for name := range t.secretProviders() {
+			recording[name] = func(args ...any) string {
+				r.calls = append(r.calls, secretCall{args: args, name: name})
+				return prefetchMarker
+			}
+		}
+		return NewTemplate(recording, WithStringResults())
+	})
+	return r
+}
+
+type secretCall struct {
+	args []any
+	fn   any
+	name string
+	path string
+	// provider is the name of the provider of the function in the registry
+	// of the Template, if known
+	provider string
+}
+
+// secretCaller is implemented by executors that can report the secret
+// function calls that executing a value would make.
+type secretCaller interface {
+	auditCalls(name string, value any) ([]secretCall, error)
+	prefetchWorkers() int
+	recordCalls(name string, value any) []secretCall
+	secretCalls(name string, value any) []secretCall
+}
+
+func (t *Template) prefetchWorkers() int {
+	if t.prefetch == nil {
+		return 0
+	}
+	return t.prefetch.workers
+}
+
+// secretCalls returns the calls to the functions named in WithPrefetch that
+// executing value would make, other than those whose arguments depend on the
+// result of another secret function.
+func (t *Template) secretCalls(name string, value any) []secretCall {
+	if t.prefetch == nil {
+		return nil
+	}
+	return slices.DeleteFunc(t.recordCalls(name, value), func(call secretCall) bool {
+		return !slices.Contains(t.prefetch.funcs, call.name) ||
+			slices.ContainsFunc(call.args, func(arg any) bool {
+				s, ok := arg.(string)
+				return ok && strings.Contains(s, prefetchMarker)
+			})
+	})
+}
+
+// recordCalls executes value with the secret functions replaced by recording
+// functions and returns the calls they recorded, including those whose
+// arguments depend on the result of another secret function.
+func (t *Template) recordCalls(name string, value any) []secretCall {
+	str, ok := value.(string)
+	if !ok || !strings.Contains(str, "{{") || len(t.secretProviders()) == 0 {
+		return nil
+	}
+
+	r := t.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+	// failures are expected as the recording functions do not return real
+	// values, any calls made before the failure are still recorded
+	_, _ = r.recorder().withData(t.templateData()).Execute(name, value)
+
+	calls := make([]secretCall, 0, len(r.calls))
+	for _, call := range r.calls {
+		call.fn = t.function(call.name)
+		call.path = name
+		calls = append(calls, call)
+	}
+	r.calls = nil
+	return calls
+}
+
+// key identifies calls that will return the same result.
+func (c secretCall) key() string {
+	return fmt.Sprintf("%s%q", c.name, c.args)
+}
+
+// invoke calls the secret function with the recorded arguments.
+func (c secretCall) invoke() error {
+	fv := reflect.ValueOf(c.fn)
+	ft := fv.Type()
+	if ft.IsVariadic() && len(c.args) < ft.NumIn()-1 ||
+		!ft.IsVariadic() && len(c.args) != ft.NumIn() {
+		return fmt.Errorf("wrong number of args for %s: got %d", c.name, len(c.args))
+	}
+
+	in := make([]reflect.Value, len(c.args))
+	for i, arg := range c.args {
+		var argType reflect.Type
+		if ft.IsVariadic() && i >= ft.NumIn()-1 {
+			argType = ft.In(ft.NumIn() - 1).Elem()
+		} else {
+			argType = ft.In(i)
+		}
+
+		av := reflect.ValueOf(arg)
+		switch {
+		case !av.IsValid():
+			in[i] = reflect.Zero(argType)
+		case av.Type().AssignableTo(argType):
+			in[i] = av
+		case av.Kind() == argType.Kind():
+			in[i] = av.Convert(argType)
+		default:
+			return fmt.Errorf("wrong type for arg %d of %s: %T", i, c.name, arg)
+		}
+	}
+
+	out := fv.Call(in)
+	if len(out) > 0 {
+		if err, ok := out[len(out)-1].Interface().(error); ok && err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secretCollector is an Executor that collects the secret calls of each value
+// it is passed and returns the value unmodified. The executor that would
+// render each value is obtained from lookup.
+type secretCollector struct {
+	calls   []secretCall
+	lookup  func(name string, value any) Executor
+	workers int
+}
+
+func (c *secretCollector) Execute(name string, value any) (any, error) {
+	if caller, ok := c.lookup(name, value).(secretCaller); ok {
+		c.calls = append(c.calls, caller.secretCalls(name, value)...)
+		c.workers = max(c.workers, caller.prefetchWorkers())
+	}
+	return value, nil
+}
+
+// prefetch makes each distinct collected call using a bounded pool of workers.
+func (c *secretCollector) prefetch() error {
+	if len(c.calls) == 0 {
+		return nil
+	}
+
+	// walk order is not deterministic, so order by path to make the reported
+	// errors so
+	slices.SortStableFunc(c.calls, func(a, b secretCall) int {
+		return strings.Compare(a.path, b.path)
+	})
+	seen := map[string]bool{}
+	calls := slices.DeleteFunc(c.calls, func(call secretCall) bool {
+		key := call.key()
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+		return false
+	})
+
+	errs := make([]error, len(calls))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(c.workers, len(calls)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				err := calls[i].invoke()
+				if err != nil {
+					errs[i] = fmt.Errorf("%s: %s: %w", calls[i].path, calls[i].name, err)
+				}
+			}
+		}()
+	}
+	for i := range calls {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if err != nil {
+		return fmt.Errorf("prefetch secrets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+//nolint:goconst // explicit strings have explanatory value in tests
+package config_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+// slowLookup records the ids looked up and the maximum number of concurrent
+// lookups.
+type slowLookup struct {
+	active    int
+	ids       []string
+	maxActive int
+	mu        sync.Mutex
+}
+
+func (l *slowLookup) lookup(id string) ([]byte, error) {
+	l.mu.Lock()
+	l.active++
+	l.maxActive = max(l.maxActive, l.active)
+	l.ids = append(l.ids, id)
+	l.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+
+	if id == "missing-a" || id == "missing-b" {
+		return nil, errors.New("not found")
+	}
+	return []byte("secret-" + id), nil
+}
+
+func TestPrefetch(t *testing.T) {
+	newTemplate := func(workers int) (*slowLookup, *config.Template) {
+		l := &slowLookup{}
+		lookup := secrets.NewCache().Wrap("test", l.lookup)
+		return l, config.NewTemplate(
+			template.FuncMap{
+				"secret": func(id string) (string, error) {
+					b, err := lookup(id)
+					return string(b), err
+				},
+				"secretField": func(id string, field string) (string, error) {
+					b, err := lookup(id)
+					return fmt.Sprintf("%s-%s", b, field), err
+				},
+			},
+			config.WithPrefetch(workers, "secret", "secretField"),
+			config.WithStringResults())
+	}
+
+	t.Run("parallel", func(t *testing.T) {
+		l, tmpl := newTemplate(3)
+
+		var cfg map[string]string
+		err := config.RawSource[map[string]string]{
+			Data: []byte(`
+a: '{{ secret "a" }}'
+b: '{{ secret "b" }}'
+c: '{{ secretField "c" "user" }}'
+d: '{{ secret "d" | printf "%s!" }}'
+e: '{{ secret "a" }}-{{ secretField "b" "user" }}'
+f: '{{ if eq (secret "f") "secret-f" }}yes{{ end }}'
+g: '{{ secret (secret "a") }}'
+`),
+			Unmarshal: config.YamlValueTemplateUnmarshal[map[string]string](tmpl),
+		}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t,
+			map[string]string{
+				"a": "secret-a",
+				"b": "secret-b",
+				"c": "secret-c-user",
+				"d": "secret-d!",
+				"e": "secret-a-secret-b-user",
+				"f": "yes",
+				"g": "secret-secret-a",
+			},
+			cfg)
+		require.Equal(t, 3, l.maxActive)
+		// each secret is only looked up once, g depends on the result of
+		// another lookup so is only fetched when rendered
+		require.ElementsMatch(t, []string{"a", "b", "c", "d", "f", "secret-a"}, l.ids)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for range 5 {
+			_, tmpl := newTemplate(4)
+
+			var cfg map[string]string
+			err := config.RawSource[map[string]string]{
+				Data: []byte(`
+z: '{{ secret "missing-a" }}'
+a: '{{ secret "ok" }}'
+m: '{{ secret "missing-b" }}'
+n: '{{ secret "missing-a" }}'
+`),
+				Unmarshal: config.YamlValueTemplateUnmarshal[map[string]string](tmpl),
+			}.Load(&cfg)
+			require.EqualError(t, err,
+				"load from raw: unmarshal: yamlunmarshal: prefetch secrets: "+
+					"/m: secret: not found\n"+
+					"/n: secret: not found")
+		}
+	})
+
+	t.Run("deferred", func(t *testing.T) {
+		l, tmpl := newTemplate(4)
+		unmarshal := config.YamlValueTemplateUnmarshalContext[map[string]string](tmpl)
+
+		var cfg map[string]string
+		err := config.Sources[map[string]string]{
+			config.RawSource[map[string]string]{
+				Data:             []byte(`{a: '{{ secret "a" }}', b: '{{ secret "b" }}'}`),
+				UnmarshalContext: unmarshal,
+			},
+			config.RawSource[map[string]string]{
+				Data:             []byte(`{b: '{{ secret "c" }}'}`),
+				UnmarshalContext: unmarshal,
+			},
+		}.Load(&cfg, config.WithDeferredTemplates())
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"a": "secret-a", "b": "secret-c"}, cfg)
+		require.Equal(t, 2, l.maxActive)
+		require.ElementsMatch(t, []string{"a", "c"}, l.ids)
+	})
+}
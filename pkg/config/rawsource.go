@@ -1,18 +1,27 @@
 package config
 
 import (
+	"context"
 	"fmt"
 )
 
 type RawSource[T any] struct {
 	Data []byte
 	// Unmarshal is the function to unmarshal the data from the file into the
-	// cfg object. If not specified YamlUnmarshal will be used.
+	// cfg object. If not specified ExtensionUnmarshal(YamlUnmarshal) will be
+	// used, which unmarshals the data as yaml as it has no extension.
 	Unmarshal func(b []byte, cfg *T) error
+	// UnmarshalContext, if specified, is used in place of Unmarshal and is
+	// passed the ctx of LoadContext (see ContextSourceLoader).
+	UnmarshalContext func(ctx context.Context, b []byte, cfg *T) error
 }
 
 func (s RawSource[T]) Load(cfg *T) error {
-	err := unmarshal(s.Data, cfg, s.Unmarshal)
+	return s.LoadContext(context.Background(), cfg)
+}
+
+func (s RawSource[T]) LoadContext(ctx context.Context, cfg *T) error {
+	err := unmarshal(ctx, "", s.Data, cfg, s.Unmarshal, s.UnmarshalContext)
 	if err != nil {
 		return fmt.Errorf("load from raw: %w", err)
 	}
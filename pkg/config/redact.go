@@ -0,0 +1,323 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redaction determines which values of a config are masked by Redact.
+type Redaction struct {
+	// Paths are dot separated key path globs (ie: `**.password`,
+	// `*.token`, `db.*_key`). Each key is matched using path.Match, `*`
+	// matches a single key, and `**` matches any number of keys (including
+	// none). List items are matched by their index.
+	Paths []string
+	// SecretPaths are the paths (ie: /db/password) of values known to be
+	// secret, such as those recorded by WithSecretPaths.
+	SecretPaths []string
+}
+
+// secretRecorder records the paths of the values rendered by templates that
+// call secret functions (see secretFuncProviders).
+type secretRecorder struct {
+	secretCaller
+	executor Executor
+	paths    map[string]bool
+}
+
+// WithSecretPaths will set paths to the paths (ie: /db/password) of the
+// values that were rendered by YamlValueTemplateUnmarshalContext templates
+// calling secret functions. These are the functions added by WithRegistry,
+// named in WithPrefetch, or named as one of the secret functions of
+// DefaultFuncMap. Values overridden by a later source are not included.
+func WithSecretPaths(paths *[]string) LoadOption {
+	return func(o *loadOptions) {
+		o.secretPaths = paths
+	}
+}
+
+// Redact returns a deep copy of cfg with the values matching redaction
+// replaced by Redacted. As the copy is of type T, masked values that cannot
+// hold Redacted (ie: a port) are set to their zero value, see RedactNode to
+// mask values of any type. Struct fields tagged `secret:"true"` are always
+// masked, and Secrets are left as is as they are always marshaled as Redacted.
+func Redact[T any](cfg *T, redaction Redaction) *T {
+	if cfg == nil {
+		return nil
+	}
+	redacted := reflect.New(reflect.TypeFor[T]())
+	redacted.Elem().Set(deepCopy(reflect.ValueOf(cfg).Elem(), false))
+	redactValue(redacted.Elem(), nil, redaction.matcher(reflect.TypeFor[T]()))
+	return redacted.Interface().(*T) //nolint:forcetypeassert // created as *T above
+}
+
+// RedactNode returns cfg encoded as a yaml.Node with the values matching
+// redaction replaced by Redacted. Values of any type (ie: a port or a list of
+// keys) are masked as the node, unlike T, can hold Redacted in their place.
+// Struct fields tagged `secret:"true"` are always masked.
+func RedactNode[T any](cfg *T, redaction Redaction) (*yaml.Node, error) {
+	var node yaml.Node
+	err := node.Encode(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("redact encode: %w", err)
+	}
+
+	redactNode(&node, nil, redaction.matcher(reflect.TypeFor[T]()))
+	return &node, nil
+}
+
+// matcher returns a function that reports whether the value at keys is
+// masked, including the struct fields of t tagged `secret:"true"`.
+func (r Redaction) matcher(t reflect.Type) func(keys []string) bool {
+	globs := slices.Clone(r.Paths)
+	globs = append(globs, taggedSecretPaths(t, nil, nil)...)
+	patterns := make([][]string, len(globs))
+	for i, glob := range globs {
+		patterns[i] = strings.Split(glob, ".")
+	}
+
+	return func(keys []string) bool {
+		return slices.Contains(r.SecretPaths, "/"+strings.Join(keys, "/")) ||
+			slices.ContainsFunc(patterns, func(pattern []string) bool { return matchKeys(pattern, keys) })
+	}
+}
+
+func (r secretRecorder) Execute(name string, value any) (any, error) {
+	v, err := r.executor.Execute(name, value)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // recording is transparent
+	}
+	if len(r.recordCalls(name, value)) > 0 {
+		r.paths[name] = true
+	}
+	return v, nil
+}
+
+func (r secretRecorder) executeKey(name string, key string) (string, error) {
+	return executeKey(r.executor, name, key)
+}
+
+// recordSecretValues records the value in cfg of each of the paths recorded
+// by secretRecorder since the last call. It is called once the source that
+// rendered them has been loaded, so the values are those produced by that
+// source (converted to the type of their field).
+func (l *loadContext) recordSecretValues(cfg any) error {
+	if len(l.secrets) == 0 {
+		return nil
+	}
+	err := Walk(executorFunc(func(name string, value any) (any, error) {
+		if l.secrets[name] {
+			l.secretValues[name] = value
+		}
+		return value, nil
+	}), cfg)
+	if err != nil {
+		return err
+	}
+	clear(l.secrets)
+	return nil
+}
+
+// secretValuePaths returns the paths of the values in cfg that still hold the
+// value recorded by recordSecretValues, that is the values that were not
+// overridden by a later source.
+func (l *loadContext) secretValuePaths(cfg any) ([]string, error) {
+	var paths []string
+	err := Walk(executorFunc(func(name string, value any) (any, error) {
+		if v, ok := l.secretValues[name]; ok && reflect.DeepEqual(v, value) {
+			paths = append(paths, name)
+		}
+		return value, nil
+	}), cfg)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// redactNode replaces the nodes matching masked with Redacted.
+func redactNode(node *yaml.Node, keys []string, masked func(keys []string) bool) {
+	if len(keys) > 0 && node.Kind != yaml.DocumentNode && masked(keys) {
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: Redacted}
+		return
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			redactNode(child, keys, masked)
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			redactNode(node.Content[i+1], append(keys, node.Content[i].Value), masked)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			redactNode(child, append(keys, fmt.Sprint(i)), masked)
+		}
+	case yaml.ScalarNode, yaml.AliasNode:
+	}
+}
+
+// redactValue replaces the values of v matching masked with Redacted, or their
+// zero value if they cannot hold it. v must be settable unless it is a map,
+// pointer or slice.
+func redactValue(v reflect.Value, keys []string, masked func(keys []string) bool) {
+	if len(keys) > 0 && masked(keys) {
+		maskValue(v)
+		return
+	}
+	eachChild(v, keys, func(child reflect.Value, keys []string) {
+		redactValue(child, keys, masked)
+	})
+}
+
+// maskValue replaces v with Redacted if it can hold it, otherwise the leaf
+// values of v are replaced with Redacted, or their zero value if they cannot
+// hold it.
+func maskValue(v reflect.Value) {
+	//nolint:exhaustive // all other kinds are zeroed
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(Redacted)
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(Redacted))
+	case reflect.Pointer, reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		eachChild(v, nil, func(child reflect.Value, _ []string) {
+			maskValue(child)
+		})
+	default:
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
+
+// eachChild calls fn with each of the values held by v (ie: the fields of a
+// struct) along with their keys, then sets them back into v. Secrets are not
+// descended into as they are always marshaled as Redacted.
+func eachChild(v reflect.Value, keys []string, fn func(child reflect.Value, keys []string)) {
+	//nolint:exhaustive // all other kinds are leaf values
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		// the value of an interface is not settable, so use a copy
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		fn(elem, keys)
+		v.Set(elem)
+	case reflect.Pointer:
+		if !v.IsNil() {
+			fn(v.Elem(), keys)
+		}
+	case reflect.Struct:
+		if _, ok := v.Addr().Interface().(secret); ok {
+			return
+		}
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, inline, skip := yamlFieldName(field)
+			if skip {
+				continue
+			}
+			fieldKeys := keys
+			if !inline {
+				fieldKeys = append(slices.Clip(keys), name)
+			}
+			fn(v.Field(i), fieldKeys)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// map values are not addressable so use a copy
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			fn(value, append(slices.Clip(keys), fmt.Sprint(iter.Key().Interface())))
+			v.SetMapIndex(iter.Key(), value)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			fn(v.Index(i), append(slices.Clip(keys), strconv.Itoa(i)))
+		}
+	}
+}
+
+// matchKeys returns true if keys match the pattern where `**` matches any
+// number of keys.
+func matchKeys(pattern []string, keys []string) bool {
+	if len(pattern) == 0 {
+		return len(keys) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(keys); i++ {
+			if matchKeys(pattern[1:], keys[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(keys) == 0 {
+		return false
+	}
+	matched, err := path.Match(pattern[0], keys[0])
+	return err == nil && matched && matchKeys(pattern[1:], keys[1:])
+}
+
+// taggedSecretPaths returns the key path globs of the struct fields in t that
+// are tagged `secret:"true"`. Map keys and list indexes are matched using `*`.
+func taggedSecretPaths(t reflect.Type, keys []string, seen []reflect.Type) []string {
+	//nolint:exhaustive // all other kinds cannot contain tagged fields
+	switch t.Kind() {
+	case reflect.Pointer:
+		return taggedSecretPaths(t.Elem(), keys, seen)
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return taggedSecretPaths(t.Elem(), append(slices.Clip(keys), "*"), seen)
+	case reflect.Struct:
+		// guard against recursive types
+		if slices.Contains(seen, t) {
+			return nil
+		}
+		seen = append(slices.Clip(seen), t)
+
+		var paths []string
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, inline, skip := yamlFieldName(field)
+			if skip {
+				continue
+			}
+			fieldKeys := keys
+			if !inline {
+				fieldKeys = append(slices.Clip(keys), name)
+			}
+			if field.Tag.Get("secret") == "true" {
+				paths = append(paths, strings.Join(fieldKeys, "."))
+				continue
+			}
+			paths = append(paths, taggedSecretPaths(field.Type, fieldKeys, seen)...)
+		}
+		return paths
+	}
+	return nil
+}
+
+// executorFunc adapts a function to an Executor.
+type executorFunc func(name string, value any) (any, error)
+
+func (f executorFunc) Execute(name string, value any) (any, error) {
+	return f(name, value)
+}
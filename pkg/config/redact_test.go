@@ -0,0 +1,185 @@
+package config_test
+
+import (
+	"testing"
+	"text/template"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRedact(t *testing.T) {
+	type User struct {
+		Name     string `yaml:"name"`
+		Password string `yaml:"password"`
+		Key      string `yaml:"key" secret:"true"`
+	}
+	type Config struct {
+		Password string          `yaml:"password"`
+		Token    string          `yaml:"token"`
+		Users    []User          `yaml:"users"`
+		Services map[string]User `yaml:"services"`
+		Port     int             `yaml:"port"`
+	}
+	cfg := Config{
+		Password: "pass",
+		Token:    "token",
+		Users:    []User{{Name: "a", Password: "a-pass", Key: "a-key"}},
+		Services: map[string]User{"db": {Name: "db", Password: "db-pass", Key: "db-key"}},
+		Port:     8080,
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		secrets []string
+		// expected is the yaml of the redacted node
+		expected string
+		// expectedCopy is the yaml of the redacted copy, if it differs as
+		// masked values that cannot hold Redacted are zeroed
+		expectedCopy string
+	}{
+		{
+			name:  "any depth",
+			paths: []string{"**.password"},
+			expected: `
+password: '***'
+token: token
+users: [{name: a, password: '***', key: '***'}]
+services: {db: {name: db, password: '***', key: '***'}}
+port: 8080
+`,
+		},
+		{
+			name:  "single key",
+			paths: []string{"*.password", "token", "users.*.name", "port"},
+			expected: `
+password: pass
+token: '***'
+users: [{name: '***', password: a-pass, key: '***'}]
+services: {db: {name: db, password: db-pass, key: '***'}}
+port: '***'
+`,
+			expectedCopy: `
+password: pass
+token: '***'
+users: [{name: '***', password: a-pass, key: '***'}]
+services: {db: {name: db, password: db-pass, key: '***'}}
+port: 0
+`,
+		},
+		{
+			name:    "secret paths",
+			secrets: []string{"/services"},
+			expected: `
+password: pass
+token: token
+users: [{name: a, password: a-pass, key: '***'}]
+services: '***'
+port: 8080
+`,
+			expectedCopy: `
+password: pass
+token: token
+users: [{name: a, password: a-pass, key: '***'}]
+services: {db: {name: '***', password: '***', key: '***'}}
+port: 8080
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redaction := config.Redaction{Paths: test.paths, SecretPaths: test.secrets}
+			node, err := config.RedactNode(&cfg, redaction)
+			require.NoError(t, err)
+			b, err := yaml.Marshal(node)
+			require.NoError(t, err)
+			require.YAMLEq(t, test.expected, string(b))
+
+			expectedCopy := test.expectedCopy
+			if expectedCopy == "" {
+				expectedCopy = test.expected
+			}
+			b, err = yaml.Marshal(config.Redact(&cfg, redaction))
+			require.NoError(t, err)
+			require.YAMLEq(t, expectedCopy, string(b))
+
+			require.Equal(t, "pass", cfg.Password)
+			require.Equal(t, "db-pass", cfg.Services["db"].Password)
+		})
+	}
+
+	t.Run("untyped", func(t *testing.T) {
+		// values of any type are masked in an untyped copy
+		cfg := map[any]any{"db": map[string]any{"password": "pass", "port": 5432, "hosts": []any{"a"}}}
+		redacted := config.Redact(&cfg, config.Redaction{Paths: []string{"db.port", "db.hosts"}, SecretPaths: []string{"/db/password"}})
+		require.Equal(t,
+			map[any]any{"db": map[string]any{"password": config.Redacted, "port": config.Redacted, "hosts": config.Redacted}},
+			*redacted)
+		require.Equal(t, 5432, cfg["db"].(map[string]any)["port"])
+	})
+}
+
+func TestWithSecretPaths(t *testing.T) {
+	type Config struct {
+		Name     string `yaml:"name"`
+		Password string `yaml:"password"`
+		Port     any    `yaml:"port"`
+		Token    string `yaml:"token"`
+	}
+
+	unmarshal := config.YamlValueTemplateUnmarshalContext[Config](
+		config.NewTemplate(
+			template.FuncMap{
+				"port":   func() string { return "5432" },
+				"secret": func(id string) string { return "secret-" + id },
+				"upper":  func(s string) string { return s + "!" },
+			},
+			config.WithPrefetch(1, "port", "secret")))
+
+	for _, opts := range [][]config.LoadOption{nil, {config.WithDeferredTemplates()}} {
+		var paths []string
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{
+				Data: []byte(`
+name: '{{ upper "name" }}'
+password: '{{ secret "password" }}'
+port: '{{ port }}'
+token: '{{ secret "token" }}'
+`),
+				UnmarshalContext: unmarshal,
+			},
+			config.RawSource[Config]{Data: []byte(`token: plain`)},
+		}.Load(&cfg, append(opts, config.WithSecretPaths(&paths))...)
+		require.NoError(t, err)
+		// deferred templates interpret the port as json
+		require.EqualValues(t, 5432, cfg.Port)
+		cfg.Port = nil
+		require.Equal(t, Config{Name: "name!", Password: "secret-password", Token: "plain"}, cfg)
+		require.Equal(t, []string{"/password", "/port"}, paths)
+	}
+
+	t.Run("without prefetch", func(t *testing.T) {
+		// the secret functions of DefaultFuncMap are recognised by name
+		var paths []string
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{
+				Data: []byte(`
+name: '{{ upper "name" }}'
+password: '{{ secret "test" "password" }}'
+`),
+				UnmarshalContext: config.YamlValueTemplateUnmarshalContext[Config](
+					config.NewTemplate(template.FuncMap{
+						"secret": func(_ string, id string) string { return "secret-" + id },
+						"upper":  func(s string) string { return s + "!" },
+					})),
+			},
+		}.Load(&cfg, config.WithSecretPaths(&paths))
+		require.NoError(t, err)
+		require.Equal(t, "secret-password", cfg.Password)
+		require.Equal(t, []string{"/password"}, paths)
+	})
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted is what a Secret is printed, logged, and marshaled as.
+const Redacted = "***"
+
+// Secret holds a sensitive config value. It unmarshals from yaml and json like
+// T would, but is marshaled, logged and formatted (ie: `fmt.Sprintf("%v")`)
+// as Redacted so it is not revealed by accident (ie: by the config
+// subcommand). The value must be obtained explicitly using Value:
+//
+//	type AppConfig struct {
+//	    Password config.Secret[string] `yaml:"password"`
+//	}
+//
+//	db.Connect(cfg.Password.Value())
+//
+// Secrets may still be referenced by interpolation and templates while
+// loading.
+type Secret[T any] struct {
+	value T
+	// revealed marshals the value rather than Redacted, it is only set on
+	// the copies made by RevealSecrets
+	revealed bool
+}
+
+// secret is implemented by *Secret so that Walk can descend into its value.
+type secret interface {
+	reveal()
+	secretValue() reflect.Value
+}
+
+// NewSecret returns a Secret holding value.
+func NewSecret[T any](value T) Secret[T] {
+	return Secret[T]{value: value}
+}
+
+// Format implements fmt.Formatter so that all verbs print Redacted.
+func (Secret[T]) Format(f fmt.State, _ rune) {
+	_, _ = f.Write([]byte(Redacted))
+}
+
+// GoString implements fmt.GoStringer.
+func (Secret[T]) GoString() string {
+	return Redacted
+}
+
+// IsZero returns true if the value is the zero value of T so that secrets
+// can be omitted using `omitempty`.
+func (s Secret[T]) IsZero() bool {
+	v := reflect.ValueOf(&s.value).Elem()
+	return v.IsZero()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Secret[T]) MarshalJSON() ([]byte, error) {
+	if s.revealed {
+		return json.Marshal(s.value)
+	}
+	return json.Marshal(Redacted)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (Secret[T]) MarshalText() ([]byte, error) {
+	return []byte(Redacted), nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (s Secret[T]) MarshalYAML() (any, error) {
+	if s.revealed {
+		return s.value, nil
+	}
+	return Redacted, nil
+}
+
+// String implements fmt.Stringer.
+func (Secret[T]) String() string {
+	return Redacted
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Secret[T]) UnmarshalJSON(b []byte) error {
+	s.revealed = false
+	//nolint:wrapcheck // error is from the value being unmarshaled
+	return json.Unmarshal(b, &s.value)
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Secret[T]) UnmarshalYAML(node *yaml.Node) error {
+	s.revealed = false
+	//nolint:wrapcheck // error is from the value being unmarshaled
+	return node.Decode(&s.value)
+}
+
+// Value returns the secret value.
+func (s Secret[T]) Value() T {
+	return s.value
+}
+
+func (s *Secret[T]) reveal() {
+	s.revealed = true
+}
+
+func (s *Secret[T]) secretValue() reflect.Value {
+	return reflect.ValueOf(&s.value).Elem()
+}
+
+// RevealSecrets returns a deep copy of cfg in which the Secrets are marshaled
+// as their values rather than Redacted (ie: to print the config when
+// explicitly requested). cfg itself is not modified, so it remains safe to
+// share. Unexported fields are copied as is.
+func RevealSecrets[T any](cfg T) T {
+	v := reflect.ValueOf(&cfg).Elem()
+	v.Set(deepCopy(v, true))
+	return cfg
+}
+
+// deepCopy returns a deep copy of v, revealing its Secrets if reveal is true.
+func deepCopy(v reflect.Value, reveal bool) reflect.Value {
+	//nolint:exhaustive // all other kinds are copied by value
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(deepCopy(v.Elem(), reveal))
+		return copied
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(deepCopy(v.Elem(), reveal))
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), deepCopy(iter.Value(), reveal))
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			copied.Index(i).Set(deepCopy(v.Index(i), reveal))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := range v.Len() {
+			copied.Index(i).Set(deepCopy(v.Index(i), reveal))
+		}
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		if s, ok := copied.Addr().Interface().(secret); ok {
+			if reveal {
+				s.reveal()
+			}
+			value := s.secretValue()
+			value.Set(deepCopy(value, reveal))
+			return copied
+		}
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				copied.Field(i).Set(deepCopy(v.Field(i), reveal))
+			}
+		}
+		return copied
+	default:
+		return v
+	}
+}
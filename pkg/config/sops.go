@@ -0,0 +1,322 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrSopsMACMismatch is returned when the MAC of a sops file does not match
+// its content, indicating the file was modified without sops.
+var ErrSopsMACMismatch = errors.New("sops mac mismatch")
+
+// sopsMACOnlyEncryptedInitialization is written to the mac hash of files
+// encrypted with mac_only_encrypted so that their mac differs from that of the
+// same file without it.
+var sopsMACOnlyEncryptedInitialization = []byte{
+	0x8a, 0x3f, 0xd2, 0xad, 0x54, 0xce, 0x66, 0x52, 0x7b, 0x10, 0x34, 0xf3, 0xd1, 0x47, 0xbe, 0x0b,
+	0x0b, 0x97, 0x5b, 0x3b, 0xf4, 0x4f, 0x72, 0xc6, 0xfd, 0xad, 0xec, 0x81, 0x76, 0xf2, 0x7d, 0x69,
+}
+
+var sopsValuePattern = regexp.MustCompile(
+	`^ENC\[AES256_GCM,data:(.*),iv:(.*),tag:(.*),type:(.*)\]$`)
+
+// sopsMetadata is the subset of the sops metadata block needed to decrypt.
+type sopsMetadata struct {
+	Age []struct {
+		Enc       string `yaml:"enc"`
+		Recipient string `yaml:"recipient"`
+	} `yaml:"age"`
+	KeyGroups        []any  `yaml:"key_groups"`
+	LastModified     string `yaml:"lastmodified"`
+	MAC              string `yaml:"mac"`
+	MACOnlyEncrypted bool   `yaml:"mac_only_encrypted"`
+	PGP              []struct {
+		Enc         string `yaml:"enc"`
+		Fingerprint string `yaml:"fp"`
+	} `yaml:"pgp"`
+}
+
+// SopsDecrypt returns an Unmarshal function that decrypts the values of a
+// [sops] encrypted yaml (or json) file before passing the decrypted yaml to
+// unmarshal (YamlUnmarshal if nil). Only the values are encrypted in such
+// files so diffs still show which keys changed. The data key is decrypted
+// using age (see AgeDecrypt) or pgp (using gpg), and the MAC of the file is
+// verified.
+//
+// If no identities are supplied, those in $SOPS_AGE_KEY, or in the file at
+// $SOPS_AGE_KEY_FILE, are used if set, otherwise AgeIdentities.
+//
+// [sops]: https://github.com/getsops/sops
+func SopsDecrypt[T any](
+	unmarshal func(ctx context.Context, b []byte, cfg *T) error,
+	identities ...age.Identity,
+) func(ctx context.Context, b []byte, cfg *T) error {
+	if unmarshal == nil {
+		unmarshal = withoutContext(YamlUnmarshal[T]())
+	}
+	return func(ctx context.Context, b []byte, cfg *T) error {
+		decrypted, err := sopsDecrypt(b, identities)
+		if err != nil {
+			return err
+		}
+		return unmarshal(ctx, decrypted, cfg)
+	}
+}
+
+// isSops returns true if b appears to be a sops encrypted yaml or json file,
+// based on its path and content.
+func isSops(path string, b []byte) bool {
+	switch filepath.Ext(path) {
+	case ".json", ".yaml", ".yml":
+		return bytes.Contains(b, []byte("ENC[AES256_GCM,")) && bytes.Contains(b, []byte("sops"))
+	default:
+		return false
+	}
+}
+
+func sopsDecrypt(b []byte, identities []age.Identity) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("sops unmarshal: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("sops: not a mapping")
+	}
+	root := doc.Content[0]
+
+	var metadata *sopsMetadata
+	for i := 0; i < len(root.Content); i += 2 {
+		if root.Content[i].Value != "sops" {
+			continue
+		}
+		metadata = &sopsMetadata{}
+		err = root.Content[i+1].Decode(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("sops metadata: %w", err)
+		}
+		root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		break
+	}
+	if metadata == nil {
+		return nil, errors.New("sops: metadata not found")
+	}
+
+	key, err := metadata.dataKey(identities)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha512.New()
+	if metadata.MACOnlyEncrypted {
+		hash.Write(sopsMACOnlyEncryptedInitialization)
+	}
+	err = sopsDecryptNode(root, nil, key, func(value []byte, encrypted bool) {
+		if encrypted || !metadata.MACOnlyEncrypted {
+			hash.Write(value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = metadata.verifyMAC(key, fmt.Sprintf("%X", hash.Sum(nil)))
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := yaml.Marshal(root)
+	if err != nil {
+		return nil, fmt.Errorf("sops marshal: %w", err)
+	}
+	return decrypted, nil
+}
+
+// dataKey returns the data key decrypted using the first of the age or pgp
+// master keys that can be decrypted.
+func (m *sopsMetadata) dataKey(identities []age.Identity) ([]byte, error) {
+	if len(m.KeyGroups) > 0 {
+		return nil, errors.New("sops: key groups are not supported")
+	}
+
+	var errs []error
+	if len(m.Age) > 0 {
+		if len(identities) == 0 {
+			var err error
+			identities, err = sopsAgeIdentities()
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(identities) > 0 {
+			for _, key := range m.Age {
+				dataKey, err := ageDecrypt([]byte(key.Enc), identities)
+				if err == nil {
+					return dataKey, nil
+				}
+				errs = append(errs, fmt.Errorf("age %s: %w", key.Recipient, err))
+			}
+		}
+	}
+
+	for _, key := range m.PGP {
+		dataKey, err := gpgDecrypt([]byte(key.Enc))
+		if err == nil {
+			return dataKey, nil
+		}
+		errs = append(errs, fmt.Errorf("pgp %s: %w", key.Fingerprint, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("sops: no age or pgp master keys")
+	}
+	return nil, fmt.Errorf("sops: decrypt data key: %w", errors.Join(errs...))
+}
+
+func (m *sopsMetadata) verifyMAC(key []byte, computed string) error {
+	lastModified, err := time.Parse(time.RFC3339, m.LastModified)
+	if err != nil {
+		return fmt.Errorf("sops lastmodified: %w", err)
+	}
+
+	mac, _, err := sopsDecryptValue(m.MAC, key, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("sops mac: %w", err)
+	}
+	if string(mac) != computed {
+		return ErrSopsMACMismatch
+	}
+	return nil
+}
+
+// sopsAgeIdentities returns the identities in $SOPS_AGE_KEY or the file at
+// $SOPS_AGE_KEY_FILE, falling back to AgeIdentities.
+func sopsAgeIdentities() ([]age.Identity, error) {
+	if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+		identities, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("parse SOPS_AGE_KEY: %w", err)
+		}
+		return identities, nil
+	}
+	if file := os.Getenv("SOPS_AGE_KEY_FILE"); file != "" {
+		return AgeIdentitiesFromFile(file)
+	}
+	return AgeIdentities()
+}
+
+// sopsDecryptNode decrypts the scalar values of node in place, calling
+// hash with the (decrypted) value of each, in document order. As in sops, the
+// path used as additional data contains only the mapping keys.
+func sopsDecryptNode(node *yaml.Node, path []string, key []byte, hash func([]byte, bool)) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i < len(node.Content); i += 2 {
+			err := sopsDecryptNode(node.Content[i+1], append(path, node.Content[i].Value), key, hash)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			err := sopsDecryptNode(item, path, key, hash)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if !sopsValuePattern.MatchString(node.Value) {
+			hash(sopsBytes(node), false)
+			return nil
+		}
+		plain, typ, err := sopsDecryptValue(node.Value, key, strings.Join(path, ":")+":")
+		if err != nil {
+			return fmt.Errorf("sops decrypt /%s: %w", strings.Join(path, "/"), err)
+		}
+		node.Value = string(plain)
+		node.Style = 0
+		// non string values are left to be resolved as they would be in the
+		// output of `sops decrypt`
+		node.Tag = ""
+		if typ != "bool" && typ != "float" && typ != "int" {
+			node.Tag = "!!str"
+		}
+		hash(plain, true)
+	case yaml.DocumentNode, yaml.AliasNode:
+		return fmt.Errorf("sops: unsupported node at /%s", strings.Join(path, "/"))
+	}
+	return nil
+}
+
+// sopsBytes returns the bytes sops includes in the mac for an unencrypted
+// value.
+func sopsBytes(node *yaml.Node) []byte {
+	var v any
+	err := node.Decode(&v)
+	if err != nil {
+		return []byte(node.Value)
+	}
+	switch typed := v.(type) {
+	case nil:
+		return nil
+	case bool:
+		// sops formats bools as python does
+		if typed {
+			return []byte("True")
+		}
+		return []byte("False")
+	case float64:
+		return []byte(strconv.FormatFloat(typed, 'f', -1, 64))
+	case int:
+		return []byte(strconv.Itoa(typed))
+	}
+	return []byte(node.Value)
+}
+
+// sopsDecryptValue decrypts a single `ENC[AES256_GCM,...]` value returning the
+// plaintext and its type.
+func sopsDecryptValue(value string, key []byte, additionalData string) ([]byte, string, error) {
+	match := sopsValuePattern.FindStringSubmatch(value)
+	if match == nil {
+		return nil, "", errors.New("invalid encrypted value")
+	}
+
+	var parts [3][]byte
+	for i, encoded := range match[1:4] {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, "", fmt.Errorf("decode encrypted value: %w", err)
+		}
+		parts[i] = decoded
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, "", fmt.Errorf("gcm: %w", err)
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, "", fmt.Errorf("decrypt: %w", err)
+	}
+	return plain, match[4], nil
+}
@@ -0,0 +1,265 @@
+package config_test
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// sopsAge returns the sops metadata for the data key encrypted using age.
+func sopsAge(t *testing.T, recipient age.Recipient) func(key []byte) map[string]any {
+	return func(key []byte) map[string]any {
+		return map[string]any{
+			"age": []map[string]string{{
+				"enc":       string(ageEncrypt(t, recipient, true, string(key))),
+				"recipient": fmt.Sprint(recipient),
+			}},
+		}
+	}
+}
+
+// sopsEncrypt encrypts plain the way sops does, leaving values whose key ends
+// with _unencrypted in plain text. The metadata for the encrypted data key is
+// returned by masterKeys.
+func sopsEncrypt(t *testing.T, masterKeys func(key []byte) map[string]any, plain string) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	encrypt := func(value string, typ string, additionalData string) string {
+		block, err := aes.NewCipher(key)
+		require.NoError(t, err)
+		gcm, err := cipher.NewGCMWithNonceSize(block, 32)
+		require.NoError(t, err)
+		iv := make([]byte, 32)
+		_, err = rand.Read(iv)
+		require.NoError(t, err)
+		sealed := gcm.Seal(nil, iv, []byte(value), []byte(additionalData))
+		tagStart := len(sealed) - gcm.Overhead()
+		return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+			base64.StdEncoding.EncodeToString(sealed[:tagStart]),
+			base64.StdEncoding.EncodeToString(iv),
+			base64.StdEncoding.EncodeToString(sealed[tagStart:]),
+			typ)
+	}
+
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(plain), &doc))
+	hash := sha512.New()
+	var walk func(node *yaml.Node, path []string, unencrypted bool)
+	walk = func(node *yaml.Node, path []string, unencrypted bool) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i < len(node.Content); i += 2 {
+				k := node.Content[i].Value
+				walk(node.Content[i+1], append(path, k), unencrypted || strings.HasSuffix(k, "_unencrypted"))
+			}
+		case yaml.SequenceNode:
+			for _, item := range node.Content {
+				walk(item, path, unencrypted)
+			}
+		case yaml.ScalarNode:
+			if node.ShortTag() == "!!bool" {
+				// sops formats bools as python does
+				node.Value = map[bool]string{false: "False", true: "True"}[node.Value == "true"]
+			}
+			hash.Write([]byte(node.Value))
+			if unencrypted {
+				return
+			}
+			typ := strings.TrimPrefix(node.ShortTag(), "!!")
+			node.Value = encrypt(node.Value, typ, strings.Join(path, ":")+":")
+			node.Tag = "!!str"
+			node.Style = 0
+		}
+	}
+	walk(doc.Content[0], nil, false)
+
+	lastModified := time.Now().UTC().Format(time.RFC3339)
+	metadata := masterKeys(key)
+	metadata["lastmodified"] = lastModified
+	metadata["mac"] = encrypt(fmt.Sprintf("%X", hash.Sum(nil)), "str", lastModified)
+	metadata["unencrypted_suffix"] = "_unencrypted"
+	metadata["version"] = "3.8.1"
+	var metadataNode yaml.Node
+	require.NoError(t, metadataNode.Encode(metadata))
+	doc.Content[0].Content = append(doc.Content[0].Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "sops"}, &metadataNode)
+
+	b, err := yaml.Marshal(&doc)
+	require.NoError(t, err)
+	return b
+}
+
+func TestSops(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	type Database struct {
+		Hosts    []string `yaml:"hosts"`
+		Password string   `yaml:"password"`
+		Port     int      `yaml:"port"`
+	}
+	type Config struct {
+		Database        Database `yaml:"database"`
+		Debug           bool     `yaml:"debug"`
+		NameUnencrypted string   `yaml:"name_unencrypted"`
+		Pin             string   `yaml:"pin"`
+	}
+	expected := Config{
+		Database: Database{
+			Hosts:    []string{"a.example.com", "b.example.com"},
+			Password: "pass",
+			Port:     5432,
+		},
+		Debug:           true,
+		NameUnencrypted: "app",
+		Pin:             "0123",
+	}
+	encrypted := sopsEncrypt(t, sopsAge(t, identity.Recipient()), `
+database:
+  hosts:
+  - a.example.com
+  - b.example.com
+  password: pass
+  port: 5432
+debug: true
+name_unencrypted: app
+pin: "0123"
+`)
+	require.Contains(t, string(encrypted), "name_unencrypted: app")
+	require.NotContains(t, string(encrypted), "pass\n")
+
+	t.Run("detected", func(t *testing.T) {
+		t.Setenv("SOPS_AGE_KEY", identity.String())
+		file := filepath.Join(t.TempDir(), "secrets.yml")
+		require.NoError(t, os.WriteFile(file, encrypted, 0o600))
+
+		var cfg Config
+		err := config.Sources[Config]{config.FileSource[Config]{Path: file}}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("identities", func(t *testing.T) {
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{
+				Data:             encrypted,
+				UnmarshalContext: config.SopsDecrypt[Config](nil, other, identity),
+			},
+		}.Load(&cfg)
+		require.NoError(t, err)
+		require.Equal(t, expected, cfg)
+	})
+
+	t.Run("wrong identity", func(t *testing.T) {
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{Data: encrypted, UnmarshalContext: config.SopsDecrypt[Config](nil, other)},
+		}.Load(&cfg)
+		require.ErrorContains(t, err, "sops: decrypt data key")
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := strings.Replace(string(encrypted), "name_unencrypted: app", "name_unencrypted: evil", 1)
+
+		var cfg Config
+		err := config.Sources[Config]{
+			config.RawSource[Config]{Data: []byte(tampered), UnmarshalContext: config.SopsDecrypt[Config](nil, identity)},
+		}.Load(&cfg)
+		require.ErrorIs(t, err, config.ErrSopsMACMismatch)
+	})
+
+	t.Run("moved value", func(t *testing.T) {
+		var doc map[string]any
+		require.NoError(t, yaml.Unmarshal(encrypted, &doc))
+		doc["pin"] = doc["database"].(map[string]any)["password"]
+		moved, err := yaml.Marshal(doc)
+		require.NoError(t, err)
+
+		var cfg Config
+		err = config.Sources[Config]{
+			config.RawSource[Config]{Data: moved, UnmarshalContext: config.SopsDecrypt[Config](nil, identity)},
+		}.Load(&cfg)
+		require.ErrorContains(t, err, "sops decrypt /pin")
+	})
+}
+
+// TestSopsFixtures decrypts files encrypted by the sops binary (3.9.4), using
+// the age key in testdata/sops/key.txt:
+//
+//	sops encrypt --age <recipient> --unencrypted-suffix _unencrypted config.sops.yml
+//	sops encrypt --age <recipient> --unencrypted-suffix _unencrypted config.sops.json
+//	sops encrypt --age <recipient> --encrypted-regex '^(password|port|debug)$' \
+//	  --mac-only-encrypted mac-only.sops.yml
+func TestSopsFixtures(t *testing.T) {
+	identities, err := config.AgeIdentitiesFromFile(filepath.Join("testdata", "sops", "key.txt"))
+	require.NoError(t, err)
+
+	expected := map[string]any{
+		"app": map[string]any{
+			"debug":   true,
+			"name":    "example",
+			"port":    5432,
+			"ratio":   0.75,
+			"verbose": false,
+		},
+		"database": map[string]any{
+			"hosts":    []any{"a.example.com", "b.example.com"},
+			"password": "pass",
+			"replicas": []any{
+				map[string]any{"enabled": false, "name": "r1", "weight": 1.5},
+				[]any{"nested", 42},
+			},
+		},
+		"flags_unencrypted": map[string]any{
+			"count":    3,
+			"disabled": false,
+			"enabled":  true,
+			"ratio":    2.5,
+			"tags":     []any{"x", true},
+		},
+		"pin": "0123",
+	}
+
+	for _, name := range []string{"config.sops.yml", "config.sops.json", "mac-only.sops.yml"} {
+		t.Run(name, func(t *testing.T) {
+			b, err := os.ReadFile(filepath.Join("testdata", "sops", name))
+			require.NoError(t, err)
+
+			var cfg map[string]any
+			err = config.SopsDecrypt[map[string]any](nil, identities...)(context.Background(), b, &cfg)
+			require.NoError(t, err)
+			require.Equal(t, expected, cfg)
+		})
+	}
+
+	t.Run("tampered bool", func(t *testing.T) {
+		b, err := os.ReadFile(filepath.Join("testdata", "sops", "config.sops.yml"))
+		require.NoError(t, err)
+		tampered := strings.Replace(string(b), "    enabled: true", "    enabled: false", 1)
+		require.NotEqual(t, string(b), tampered)
+
+		var cfg map[string]any
+		err = config.SopsDecrypt[map[string]any](nil, identities...)(context.Background(), []byte(tampered), &cfg)
+		require.ErrorIs(t, err, config.ErrSopsMACMismatch)
+	})
+}
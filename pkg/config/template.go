@@ -2,28 +2,155 @@ package config
 
 import (
 	"bytes"
+	"container/list"
+	"context"
 	"encoding/json"
 	"fmt"
-	"strconv"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/pastdev/configloader/pkg/bitwarden"
+	"github.com/pastdev/configloader/pkg/credentials"
+	"github.com/pastdev/configloader/pkg/keepass"
+	"github.com/pastdev/configloader/pkg/keyring"
 	"github.com/pastdev/configloader/pkg/lastpass"
+	"github.com/pastdev/configloader/pkg/onepassword"
+	"github.com/pastdev/configloader/pkg/passwordstore"
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/pastdev/configloader/pkg/vault"
 	"github.com/pastdev/configloader/pkg/xdg"
 	"gopkg.in/yaml.v3"
 )
 
+// DefaultRegistry returns a registry containing all of the secret providers
+// supported by this library.
+func DefaultRegistry() *secrets.Registry {
+	registry := secrets.NewRegistry()
+	registry.Register("bitwarden", bitwarden.New())
+	registry.Register("credentials", credentials.New())
+	registry.Register("keepass", keepass.New(registry))
+	registry.Register("keyring", keyring.New())
+	registry.Register("lastpass", lastpass.New())
+	registry.Register("onepassword", onepassword.New())
+	registry.Register("passwordstore", passwordstore.New())
+	registry.Register("vault", vault.New())
+	return registry
+}
+
+// DefaultFuncMap returns the generic `secret` function and provider specific
+// functions for all the providers in DefaultRegistry, along with the xdg
+// functions. The secret functions are not memoized, see WithRegistry.
 func DefaultFuncMap() map[string]any {
 	funcs := map[string]any{}
-	bitwarden.New().AddFuncs(funcs)
-	lastpass.New().AddFuncs(funcs)
+	DefaultRegistry().AddFuncs(funcs)
 	xdg.AddFuncs(funcs)
 	return funcs
 }
 
+// WithRegistry adds the functions of registry to the Template. Unlike adding
+// them to the funcMap, the lookups of the caching providers (see
+// secrets.CachingProvider) are memoized for the duration of each load (when
+// used by an UnmarshalContext function), so an entry is only fetched once no
+// matter how many values reference it.
+func WithRegistry(registry *secrets.Registry) TemplateOption {
+	return func(t *Template) {
+		registry.AddFuncs(t.funcMap)
+		t.registry = registry
+	}
+}
+
+// WithSecretCache configures the cache that memoizes the secret lookups of
+// each load (see WithRegistry), ie: to persist them, encrypted, for a TTL.
+func WithSecretCache(opts ...secrets.CacheOption) LoadOption {
+	return func(o *loadOptions) {
+		o.cacheOptions = opts
+	}
+}
+
+// Markers prefixed to the output of the raw and json template functions so
+// that Execute can tell how the result should be interpreted. The markers are
+// detected anywhere in the output, so the functions may be preceded by other
+// text, but they must be the last function of a pipeline. resultMarkerName
+// remaining once the markers are removed means a marker was altered (ie: by
+// printf "%q").
+const (
+	jsonResultMarker = "\x00" + resultMarkerName + "-json\x00"
+	rawResultMarker  = "\x00" + resultMarkerName + "-raw\x00"
+	resultMarkerName = "configloader-result"
+)
+
 type Template struct {
-	funcMap map[string]any
+	cache *templateCache
+	data  *TemplateData
+	// defaultData returns the data used when none was supplied, it is shared
+	// by all copies of the Template so that it is only computed once
+	defaultData func() *TemplateData
+	funcMap     map[string]any
+	prefetch    *prefetchOptions
+	recorder    *callRecorder
+	registry    *secrets.Registry
+	// secretFuncs, if set, replace the functions of registry with those
+	// memoized by the cache of the current load
+	secretFuncs template.FuncMap
+	// secretProviders returns the secretFuncProviders, it is shared by all
+	// copies of the Template so that they are only found once
+	secretProviders func() map[string]string
+	stringResults   bool
+}
+
+// TemplateOption configures a Template.
+type TemplateOption func(*Template)
+
+// WithStringResults will keep the result of every template as a string rather
+// than making a best effort attempt at parsing it as json. Individual values
+// can still opt into json parsing using the json function:
+//
+//	obj: '{{ bitwardenJSON "example.com" | json }}'
+func WithStringResults() TemplateOption {
+	return func(t *Template) {
+		t.stringResults = true
+	}
+}
+
+// maxCachedTemplates is the number of parsed values and files retained by a
+// Template. Once exceeded, the least recently used are discarded.
+const maxCachedTemplates = 4096
+
+// templateCache holds parsed templates keyed by their content. It is shared by
+// all copies of a Template (ie: those returned by WithData) so that each
+// distinct value is only parsed once no matter how many times, or at how many
+// paths, it is loaded. Each value is parsed into its own clone of root so that
+// templates defined by one value are not visible to others. As a parsed
+// template is shared by every path with the same content, it is named for the
+// kind of template rather than the path (see valueTemplateName).
+type templateCache struct {
+	entries map[templateKey]*list.Element
+	// lru holds the *templateEntry of each entry, most recently used first
+	lru *list.List
+	mu  sync.Mutex
+	// root holds the functions of the Template, cloning it is cheaper than
+	// adding the functions to each new template
+	root *template.Template
+}
+
+// Names of the parsed templates, errors are wrapped with the path instead.
+const (
+	fileTemplateName  = "config"
+	valueTemplateName = "value"
+)
+
+type templateKey struct {
+	// file is true for entire files (see TemplateUnmarshal)
+	file bool
+	text string
+}
+
+type templateEntry struct {
+	key  templateKey
+	tmpl *template.Template
 }
 
 type Executor interface {
@@ -39,91 +166,268 @@ func (t *Template) Execute(name string, value any) (any, error) {
 		return value, nil
 	}
 
-	tmpl, err := template.New(name).Funcs(t.funcMap).Parse(str)
+	out, err := t.execute(name, str)
 	if err != nil {
-		return nil, fmt.Errorf("new template: %w", err)
+		return nil, err
 	}
 
-	var newValue bytes.Buffer
-	err = tmpl.Execute(&newValue, nil)
+	parseJSON := !t.stringResults
+	strict := false
+	hasRaw := strings.Contains(out, rawResultMarker)
+	hasJSON := strings.Contains(out, jsonResultMarker)
+	switch {
+	case hasRaw && hasJSON:
+		return nil, fmt.Errorf("result of %s uses both raw and json", name)
+	case hasRaw:
+		parseJSON = false
+	case hasJSON:
+		parseJSON = true
+		strict = true
+	}
+	raw, err := resultString(name, out)
 	if err != nil {
-		return nil, fmt.Errorf("execute template: %w", err)
+		return nil, err
+	}
+
+	if !parseJSON {
+		return raw, nil
 	}
 
-	raw := newValue.Bytes()
 	var parsed any
-	err = json.Unmarshal(raw, &parsed)
+	err = json.Unmarshal([]byte(raw), &parsed)
 	if err != nil {
+		if strict {
+			return nil, fmt.Errorf("parse json result of %s: %w", name, err)
+		}
 		//nolint: nilerr // json parse is best effort
-		return string(raw), nil
+		return raw, nil
 	}
 	return parsed, nil
 }
 
-func NewTemplate(funcMap template.FuncMap) *Template {
-	return &Template{
-		funcMap: funcMap,
+// executeKey renders key as is, the result is never parsed as json.
+func (t *Template) executeKey(name string, key string) (string, error) {
+	if !strings.Contains(key, "{{") {
+		return key, nil
 	}
+
+	out, err := t.execute(name, key)
+	if err != nil {
+		return "", err
+	}
+	return resultString(name, out)
 }
 
-// Walk will recursively iterate over all the nodes of data calling callback
-// for each node.
-func Walk(callback Executor, data any) error {
-	_, err := walk(callback, data, []string{})
+// execute returns the output of executing text, including any result
+// markers.
+func (t *Template) execute(name string, text string) (string, error) {
+	tmpl, err := t.cache.value(text)
+	if err != nil {
+		return "", fmt.Errorf("new template %s: %w", name, err)
+	}
+	tmpl, err = t.withSecretFuncs(tmpl)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, t.templateData())
 	if err != nil {
-		return err
+		return "", fmt.Errorf("execute template %s: %w", name, err)
 	}
-	return nil
+	return out.String(), nil
 }
 
-func walk(callback Executor, node any, keyStack []string) (any, error) {
-	switch typed := node.(type) {
-	case map[string]any:
-		// json deserialized
-		for k, v := range typed {
-			keyStack := append(keyStack, fmt.Sprintf("%v", k))
-			newValue, err := walk(callback, v, keyStack)
-			if err != nil {
-				return nil, fmt.Errorf("walk array: %w", err)
-			}
-			typed[k] = newValue
-		}
-		return typed, nil
-	case map[any]any:
-		// yaml deserialized
-		for k, v := range typed {
-			keyStack := append(keyStack, fmt.Sprintf("%v", k))
-			newValue, err := walk(callback, v, keyStack)
-			if err != nil {
-				return nil, fmt.Errorf("walk array: %w", err)
-			}
-			typed[k] = newValue
-		}
-		return typed, nil
-	case []any:
-		for i, j := range typed {
-			keyStack := append(keyStack, strconv.Itoa(i))
-			newValue, err := walk(callback, j, keyStack)
+// resultString returns out without the result markers.
+func resultString(name string, out string) (string, error) {
+	raw := stripResultMarkers(out)
+	if strings.Contains(raw, resultMarkerName) {
+		return "", fmt.Errorf("result of raw or json was modified by a later function in %s", name)
+	}
+	return raw, nil
+}
+
+// WithData implements DataExecutor.
+func (t *Template) WithData(data *TemplateData) Executor {
+	return t.withData(data)
+}
+
+func (t *Template) withData(data *TemplateData) *Template {
+	withData := *t
+	withData.data = data
+	return &withData
+}
+
+// withSecretCache returns a copy of the Template whose secret functions are
+// memoized by cache.
+func (t *Template) withSecretCache(cache *secrets.Cache) *Template {
+	if t.registry == nil {
+		return t
+	}
+	withCache := *t
+	withCache.secretFuncs = template.FuncMap{}
+	t.registry.WithCache(cache).AddFuncs(withCache.secretFuncs)
+	return &withCache
+}
+
+// withSecretFuncs returns a copy of the cached tmpl using the secret functions
+// of the current load, if any. The cached template is shared by all loads so
+// it cannot be modified.
+func (t *Template) withSecretFuncs(tmpl *template.Template) (*template.Template, error) {
+	if t.secretFuncs == nil {
+		return tmpl, nil
+	}
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("clone template: %w", err)
+	}
+	return clone.Funcs(t.secretFuncs), nil
+}
+
+// function returns the named function, preferring the secret functions of the
+// current load.
+func (t *Template) function(name string) any {
+	if fn, ok := t.secretFuncs[name]; ok {
+		return fn
+	}
+	return t.funcMap[name]
+}
+
+// templateData returns the data context for the template, defaulting to one
+// populated only from the environment if none was supplied.
+func (t *Template) templateData() *TemplateData {
+	if t.data != nil {
+		return t.data
+	}
+	return t.defaultData()
+}
+
+// value returns the parsed template for text.
+func (c *templateCache) value(text string) (*template.Template, error) {
+	return c.parse(templateKey{text: text}, nil)
+}
+
+// file returns the parsed template for an entire file. prepare is called with
+// the newly parsed template before it is cached.
+func (c *templateCache) file(text string, prepare func(*template.Template)) (*template.Template, error) {
+	return c.parse(templateKey{file: true, text: text}, prepare)
+}
+
+func (c *templateCache) parse(key templateKey, prepare func(*template.Template)) (*template.Template, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		return element.Value.(*templateEntry).tmpl, nil
+	}
+
+	name := valueTemplateName
+	if key.file {
+		name = fileTemplateName
+	}
+	root, err := c.root.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("clone: %w", err)
+	}
+	tmpl, err := root.New(name).Parse(key.text)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	if prepare != nil {
+		prepare(tmpl)
+	}
+
+	c.entries[key] = c.lru.PushFront(&templateEntry{key: key, tmpl: tmpl})
+	for c.lru.Len() > maxCachedTemplates {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*templateEntry).key)
+	}
+	return tmpl, nil
+}
+
+// NewTemplate returns a Template that executes values with the supplied
+// funcMap. In addition to funcMap, the following functions are available to
+// control how the result of a template is interpreted (unless overridden by
+// funcMap):
+//
+//   - raw: the result is kept as a string (ie: `{{ password "x" | raw }}`)
+//   - json: the result must be valid json and is parsed
+//
+// Either applies to the entire result wherever it is used within the value,
+// but it must be the last function of its pipeline.
+//
+// By default, results are parsed as json when possible, and kept as a string
+// otherwise. See WithStringResults to change this.
+func NewTemplate(funcMap template.FuncMap, opts ...TemplateOption) *Template {
+	funcs := template.FuncMap{
+		"json": func(v any) string { return jsonResultMarker + fmt.Sprint(v) },
+		"raw":  func(v any) string { return rawResultMarker + fmt.Sprint(v) },
+	}
+	maps.Copy(funcs, funcMap)
+
+	t := &Template{
+		cache: &templateCache{
+			entries: map[templateKey]*list.Element{},
+			lru:     list.New(),
+		},
+		defaultData: sync.OnceValue(func() *TemplateData {
+			data, err := NewTemplateData("", nil)
 			if err != nil {
-				return nil, fmt.Errorf("walk array: %w", err)
+				// cannot fail with a nil cfg
+				return &TemplateData{}
 			}
-			typed[i] = newValue
-		}
-		return typed, nil
-	default:
-		v, err := callback.Execute(fmt.Sprintf("/%s", strings.Join(keyStack, "/")), node)
-		if err != nil {
-			return nil, fmt.Errorf("execute template: %w", err)
-		}
-		return v, nil
+			return data
+		}),
+		funcMap: funcs,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.cache.root = template.New("").Funcs(t.funcMap)
+	t.secretProviders = sync.OnceValue(t.secretFuncProviders)
+	t.recorder = newCallRecorder(t)
+	return t
+}
+
+// newDefaultTemplate returns the Template used when none is supplied.
+func newDefaultTemplate() *Template {
+	registry := DefaultRegistry()
+	funcs := map[string]any{}
+	xdg.AddFuncs(funcs)
+	return NewTemplate(
+		funcs,
+		WithRegistry(registry),
+		WithPrefetch(DefaultPrefetchWorkers, registry.FuncNames()...))
+}
+
+func stripResultMarkers(s string) string {
+	if !strings.Contains(s, "\x00") {
+		return s
 	}
+	s = strings.ReplaceAll(s, jsonResultMarker, "")
+	return strings.ReplaceAll(s, rawResultMarker, "")
 }
 
 // YamlValueTemplateUnmarshal is an Unmarshal function that unmarshals from
 // yaml, then processes each _value_ individually through the go template engine
-// then reserializes the result to yaml before unmarshaling into T.
-func YamlValueTemplateUnmarshal[T any](executor Executor) func(b []byte, cfg *T) error {
+// then reserializes the result to yaml before unmarshaling into T. The opts are
+// passed through to Walk (ie: WithKeys to also template keys). The load
+// options of Sources.Load (ie: WithDeferredTemplates) require
+// YamlValueTemplateUnmarshalContext.
+func YamlValueTemplateUnmarshal[T any](executor Executor, opts ...WalkOption) func(b []byte, cfg *T) error {
+	unmarshal := YamlValueTemplateUnmarshalContext[T](executor, opts...)
 	return func(b []byte, cfg *T) error {
+		return unmarshal(context.Background(), b, cfg)
+	}
+}
+
+// YamlValueTemplateUnmarshalContext is YamlValueTemplateUnmarshal for use as
+// the UnmarshalContext of a source, applying the load options of Sources.Load
+// passed through ctx.
+func YamlValueTemplateUnmarshalContext[T any](executor Executor, opts ...WalkOption) func(ctx context.Context, b []byte, cfg *T) error {
+	return func(ctx context.Context, b []byte, cfg *T) error {
 		var valueMap map[any]any
 		err := yaml.Unmarshal(b, &valueMap)
 		if err != nil {
@@ -131,15 +435,57 @@ func YamlValueTemplateUnmarshal[T any](executor Executor) func(b []byte, cfg *T)
 		}
 
 		if executor == nil {
-			executor = NewTemplate(DefaultFuncMap())
+			executor = newDefaultTemplate()
+		}
+
+		exec, err := templateExecutor(ctx, executor, cfg)
+		if err != nil {
+			return fmt.Errorf("yamlunmarshal template data: %w", err)
+		}
+
+		load := lookupSourceContext(ctx).load
+		caller, _ := exec.(secretCaller)
+		switch {
+		case load != nil && load.audit != nil:
+			if caller == nil {
+				return fmt.Errorf("yamlunmarshal secret audit: %T cannot report its secret calls", exec)
+			}
+			exec = auditExecutor{caller: caller, calls: load.audit}
+		case caller != nil && load != nil && load.secrets != nil:
+			exec = secretRecorder{secretCaller: caller, executor: exec, paths: load.secrets}
+		}
+
+		// when deferred, values are recorded to be executed once all sources
+		// are merged, but keys are still executed now so that they merge
+		walkExecutor := exec
+		walkOpts := opts
+		if load != nil && load.deferred != nil {
+			walkExecutor = deferringExecutor{executor: exec, pending: load.deferred}
+			walkOpts = append(slices.Clip(opts), withKeyExecutor(exec))
+		} else if _, ok := exec.(secretCaller); ok {
+			collector := &secretCollector{lookup: func(string, any) Executor { return exec }}
+			err = Walk(collector, valueMap, opts...)
+			if err != nil {
+				return fmt.Errorf("yamlunmarshal collect secrets: %w", err)
+			}
+			err = collector.prefetch()
+			if err != nil {
+				return fmt.Errorf("yamlunmarshal: %w", err)
+			}
 		}
 
 		// walk the map and template each value
-		err = Walk(executor, valueMap)
+		err = Walk(walkExecutor, valueMap, walkOpts...)
 		if err != nil {
 			return fmt.Errorf("yamlunmarshal walk valueMap: %w", err)
 		}
 
+		// an audit only needs the calls, the templates cannot be unmarshaled
+		// into fields that do not hold a string (ie: an int port)
+		if load != nil && load.audit != nil && load.deferred == nil {
+			return nil
+		}
+
 		data, err := yaml.Marshal(valueMap)
 		if err != nil {
 			return fmt.Errorf("yamlunmarshal from valueMap: %w", err)
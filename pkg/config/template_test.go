@@ -2,12 +2,19 @@
 package config_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
+	"sync/atomic"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/pastdev/configloader/pkg/config"
+	"github.com/pastdev/configloader/pkg/secrets"
 	"github.com/stretchr/testify/require"
 )
 
@@ -64,3 +71,402 @@ creds:
 			actual)
 	})
 }
+
+func TestTemplateData(t *testing.T) {
+	t.Setenv("CONFIGLOADER_TEST", "from-env")
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.tmpl.yml")
+	err = os.WriteFile(
+		path,
+		[]byte(`---
+env: '{{ .Env.CONFIGLOADER_TEST }}'
+host: '{{ .Hostname }}'
+path: '{{ .Path }}'
+url: 'https://{{ .Config.host }}:{{ .Config.port }}'
+`),
+		0o600)
+	require.NoError(t, err)
+
+	unmarshal := config.YamlValueTemplateUnmarshalContext[map[any]any](
+		config.NewTemplate(template.FuncMap{}))
+
+	var actual map[any]any
+	err = config.Sources[map[any]any]{
+		config.RawSource[map[any]any]{Data: []byte(`{"host":"example.com","port":8443}`)},
+		config.FileSource[map[any]any]{Path: path, UnmarshalContext: unmarshal},
+	}.Load(&actual)
+	require.NoError(t, err)
+	require.Equal(t,
+		map[any]any{
+			"env":  "from-env",
+			"host": hostname,
+			"path": path,
+			"port": 8443,
+			"url":  "https://example.com:8443",
+		},
+		actual)
+}
+
+func BenchmarkTemplateExecute(b *testing.B) {
+	funcMap := template.FuncMap{
+		"password": func(id string) string { return fmt.Sprintf("pass-for-%s", id) },
+	}
+
+	values := make(map[string]any, 200)
+	for i := range 200 {
+		values[fmt.Sprintf("/key%d", i)] = fmt.Sprintf(`{{ password "example%d.com" }}`, i)
+	}
+
+	data, err := config.NewTemplateData("", nil)
+	require.NoError(b, err)
+
+	execute := func(b *testing.B, tmpl *config.Template) {
+		// each load supplies its own data, as YamlValueTemplateUnmarshal does
+		exec := tmpl.WithData(data)
+		for name, value := range values {
+			_, err := exec.Execute(name, value)
+			require.NoError(b, err)
+		}
+	}
+
+	// a new template per load results in every value being parsed each time
+	b.Run("uncached", func(b *testing.B) {
+		for range b.N {
+			execute(b, config.NewTemplate(funcMap))
+		}
+	})
+
+	// reusing a template across loads only parses each distinct value once
+	b.Run("cached", func(b *testing.B) {
+		tmpl := config.NewTemplate(funcMap)
+		for range b.N {
+			execute(b, tmpl)
+		}
+	})
+}
+
+func TestTemplateCache(t *testing.T) {
+	tmpl := config.NewTemplate(template.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("failed") },
+	})
+
+	t.Run("errors name the value", func(t *testing.T) {
+		_, err := tmpl.Execute("/a", `{{ fail }}`)
+		require.ErrorContains(t, err, `execute template /a: template: value:1:3: executing "value"`)
+
+		// the template parsed for /a is shared by /b
+		_, err = tmpl.Execute("/b", `{{ fail }}`)
+		require.ErrorContains(t, err, `execute template /b: template: value:1:3: executing "value"`)
+	})
+
+	t.Run("defines are not shared", func(t *testing.T) {
+		actual, err := tmpl.Execute("/a", `{{ define "x" }}one{{ end }}{{ template "x" }}`)
+		require.NoError(t, err)
+		require.Equal(t, "one", actual)
+
+		actual, err = tmpl.Execute("/b", `{{ define "x" }}two{{ end }}{{ template "x" }}`)
+		require.NoError(t, err)
+		require.Equal(t, "two", actual)
+
+		_, err = tmpl.Execute("/c", `{{ template "x" }}`)
+		require.ErrorContains(t, err, `template "x" not defined`)
+	})
+
+	t.Run("data is not cached", func(t *testing.T) {
+		t.Setenv("CONFIGLOADER_TEST", "one")
+		tmpl := config.NewTemplate(template.FuncMap{})
+		actual, err := tmpl.Execute("/a", `{{ .Env.CONFIGLOADER_TEST }}`)
+		require.NoError(t, err)
+		require.Equal(t, "one", actual)
+
+		// the default data is computed once per Template
+		t.Setenv("CONFIGLOADER_TEST", "two")
+		actual, err = tmpl.Execute("/a", `{{ .Env.CONFIGLOADER_TEST }}`)
+		require.NoError(t, err)
+		require.Equal(t, "one", actual)
+
+		data, err := config.NewTemplateData("", nil)
+		require.NoError(t, err)
+		actual, err = tmpl.WithData(data).Execute("/a", `{{ .Env.CONFIGLOADER_TEST }}`)
+		require.NoError(t, err)
+		require.Equal(t, "two", actual)
+	})
+}
+
+func TestTemplateResults(t *testing.T) {
+	funcMap := template.FuncMap{
+		"password": func(id string) string { return id },
+	}
+
+	test := func(t *testing.T, tmpl *config.Template, value string, expected any) {
+		actual, err := tmpl.Execute("/value", value)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	t.Run("default coerces json", func(t *testing.T) {
+		tmpl := config.NewTemplate(funcMap)
+		// these are likely surprising for a password, but preserved for
+		// backwards compatibility
+		test(t, tmpl, `{{ password "123" }}`, float64(123))
+		test(t, tmpl, `{{ password "true" }}`, true)
+		test(t, tmpl, `{{ password "null" }}`, nil)
+		test(t, tmpl, `{{ password "[1]" }}`, []any{float64(1)})
+		test(t, tmpl, `{{ password "abc" }}`, "abc")
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		tmpl := config.NewTemplate(funcMap)
+		test(t, tmpl, `{{ password "123" | raw }}`, "123")
+		test(t, tmpl, `{{ password "true" | raw }}`, "true")
+		test(t, tmpl, `{{ raw (password "null") }}`, "null")
+		test(t, tmpl, ` {{ password "123" | raw }}`, " 123")
+		test(t, tmpl, `{{ password "1" }}{{ password "2" | raw }}`, "12")
+	})
+
+	t.Run("json after text", func(t *testing.T) {
+		tmpl := config.NewTemplate(funcMap, config.WithStringResults())
+		test(t, tmpl, ` {{ password "[1]" | json }}`, []any{float64(1)})
+		_, err := tmpl.Execute("/value", `a{{ password "[1]" | json }}`)
+		require.ErrorContains(t, err, "parse json result of /value")
+	})
+
+	t.Run("modified markers", func(t *testing.T) {
+		tmpl := config.NewTemplate(funcMap)
+		_, err := tmpl.Execute("/value", `{{ password "123" | raw | printf "%q" }}`)
+		require.ErrorContains(t, err, "result of raw or json was modified by a later function in /value")
+		_, err = tmpl.Execute("/value", `{{ password "1" | raw }}{{ password "2" | json }}`)
+		require.ErrorContains(t, err, "result of /value uses both raw and json")
+	})
+
+	t.Run("string results", func(t *testing.T) {
+		tmpl := config.NewTemplate(funcMap, config.WithStringResults())
+		test(t, tmpl, `{{ password "123" }}`, "123")
+		test(t, tmpl, `{{ password "true" }}`, "true")
+		test(t, tmpl, `{{ password "null" }}`, "null")
+		test(t, tmpl, `{{ password "{\"a\":1}" | json }}`, map[string]any{"a": float64(1)})
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		tmpl := config.NewTemplate(funcMap, config.WithStringResults())
+		_, err := tmpl.Execute("/value", `{{ password "abc" | json }}`)
+		require.ErrorContains(t, err, "parse json result of /value")
+	})
+
+	t.Run("string results unmarshal", func(t *testing.T) {
+		var actual map[any]any
+		err := config.YamlValueTemplateUnmarshal[map[any]any](
+			config.NewTemplate(funcMap, config.WithStringResults()))(
+			[]byte(`---
+password: '{{ password "123" }}'
+`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t, map[any]any{"password": "123"}, actual)
+	})
+}
+
+func TestYamlValueTemplateUnmarshalKeys(t *testing.T) {
+	unmarshal := config.YamlValueTemplateUnmarshal[map[any]any](
+		config.NewTemplate(template.FuncMap{
+			"region": func() string { return "us-east-1" },
+		}),
+		config.WithKeys())
+
+	t.Run("keys", func(t *testing.T) {
+		var actual map[any]any
+		err := unmarshal(
+			[]byte(`---
+regions:
+  '{{ region }}':
+    name: '{{ region }}'
+  us-west-2:
+    name: west
+`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t,
+			map[any]any{
+				"regions": map[string]any{
+					"us-east-1": map[string]any{"name": "us-east-1"},
+					"us-west-2": map[string]any{"name": "west"},
+				},
+			},
+			actual)
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		var actual map[any]any
+		err := unmarshal(
+			[]byte(`---
+regions:
+  '{{ region }}': a
+  us-east-1: b
+`),
+			&actual)
+		require.ErrorIs(t, err, config.ErrKeyCollision)
+		require.ErrorContains(t, err, `/regions: "us-east-1" and "{{ region }}" both render to "us-east-1"`)
+	})
+
+	t.Run("keys are not coerced", func(t *testing.T) {
+		var actual map[any]any
+		err := unmarshal(
+			[]byte(`---
+'{{ "1.0" }}': float
+'{{ "1e3" }}': exponent
+'{{ "null" }}': null
+'{{ "true" }}': bool
+`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t,
+			map[any]any{
+				"1.0":  "float",
+				"1e3":  "exponent",
+				"null": nil,
+				"true": "bool",
+			},
+			actual)
+	})
+
+	t.Run("typed map keys are not coerced", func(t *testing.T) {
+		var actual map[string]string
+		err := config.YamlValueTemplateUnmarshal[map[string]string](
+			config.NewTemplate(template.FuncMap{}),
+			config.WithKeys())(
+			[]byte(`'{{ "1.0" }}': '{{ "1.0" }}'`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"1.0": "1"}, actual)
+	})
+
+	t.Run("keys not templated by default", func(t *testing.T) {
+		var actual map[any]any
+		err := config.YamlValueTemplateUnmarshal[map[any]any](
+			config.NewTemplate(template.FuncMap{}))(
+			[]byte(`'{{ "a" }}': b`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t, map[any]any{`{{ "a" }}`: "b"}, actual)
+	})
+}
+
+// countingProvider is a secrets.CachingProvider that counts its lookups.
+type countingProvider struct {
+	calls  *atomic.Int32
+	lookup func(id string) ([]byte, error)
+}
+
+func newCountingProvider() countingProvider {
+	calls := &atomic.Int32{}
+	return countingProvider{
+		calls: calls,
+		lookup: func(id string) ([]byte, error) {
+			calls.Add(1)
+			return []byte(`{"password":"secret-` + id + `","username":"user-` + id + `"}`), nil
+		},
+	}
+}
+
+func (p countingProvider) Check() error {
+	return nil
+}
+
+func (p countingProvider) Get(id string) (string, error) {
+	return p.GetField(id, "password")
+}
+
+func (p countingProvider) GetField(id string, field string) (string, error) {
+	b, err := p.lookup(id)
+	if err != nil {
+		return "", err
+	}
+	var entry map[string]string
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return "", fmt.Errorf("unmarshal: %w", err)
+	}
+	return entry[field], nil
+}
+
+func (p countingProvider) List() ([]string, error) {
+	return nil, secrets.ErrNotSupported
+}
+
+func (p countingProvider) WithCache(cache *secrets.Cache) secrets.Provider {
+	p.lookup = cache.Wrap("counting", p.lookup)
+	return p
+}
+
+func TestWithRegistry(t *testing.T) {
+	provider := newCountingProvider()
+	registry := secrets.NewRegistry()
+	registry.Register("counting", provider)
+	tmpl := config.NewTemplate(template.FuncMap{}, config.WithRegistry(registry))
+
+	sources := config.Sources[map[string]string]{
+		config.RawSource[map[string]string]{
+			Data: []byte(`
+password: '{{ secret "counting" "a" }}'
+username: '{{ secret "counting" "a" "username" }}'
+`),
+			UnmarshalContext: config.YamlValueTemplateUnmarshalContext[map[string]string](tmpl),
+		},
+		config.RawSource[map[string]string]{
+			Data:             []byte(`other: '{{ secret "counting" "a" "username" }}'`),
+			UnmarshalContext: config.YamlValueTemplateUnmarshalContext[map[string]string](tmpl),
+		},
+	}
+
+	var cfg map[string]string
+	err := sources.Load(&cfg)
+	require.NoError(t, err)
+	require.Equal(t,
+		map[string]string{"other": "user-a", "password": "secret-a", "username": "user-a"},
+		cfg)
+	// each entry is looked up once per load
+	require.Equal(t, int32(1), provider.calls.Load())
+
+	// a reload looks up again
+	err = sources.Load(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), provider.calls.Load())
+
+	// lookups are only memoized within a single unmarshal outside of a load
+	for range 2 {
+		err = config.YamlValueTemplateUnmarshal[map[string]string](tmpl)(
+			[]byte(`password: '{{ secret "counting" "a" }}'`),
+			&cfg)
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(4), provider.calls.Load())
+
+	t.Run("persisted", func(t *testing.T) {
+		provider := newCountingProvider()
+		registry := secrets.NewRegistry()
+		registry.Register("counting", provider)
+		tmpl := config.NewTemplate(template.FuncMap{}, config.WithRegistry(registry))
+		sources := config.Sources[map[string]string]{
+			config.RawSource[map[string]string]{
+				Data:             []byte(`password: '{{ secret "counting" "a" }}'`),
+				UnmarshalContext: config.YamlValueTemplateUnmarshalContext[map[string]string](tmpl),
+			},
+		}
+
+		dir := t.TempDir()
+		key := []byte("0123456789abcdef0123456789abcdef")
+		for range 2 {
+			var cfg map[string]string
+			err := sources.Load(&cfg, config.WithSecretCache(
+				secrets.WithDir(dir),
+				secrets.WithTTL(time.Hour),
+				secrets.WithKey(key)))
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"password": "secret-a"}, cfg)
+		}
+		require.Equal(t, int32(1), provider.calls.Load())
+	})
+}
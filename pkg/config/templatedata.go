@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateData is the data context (`.`) available to templates. For example:
+//
+//	home: '{{ .Env.HOME }}'
+//	host: '{{ .Hostname }}'
+//	name: '{{ .User.Username }}'
+//	self: '{{ .Path }}'
+//	port: '{{ .Config.port }}'
+type TemplateData struct {
+	// Config is a read-only copy of the configuration loaded by the sources
+	// processed before the current one.
+	Config map[string]any
+	// Env is the environment of the current process.
+	Env map[string]string
+	// Hostname is the hostname reported by the kernel.
+	Hostname string
+	// Path is the path of the file currently being loaded. It is empty for
+	// sources that are not backed by a file.
+	Path string
+	// User is the current user.
+	User TemplateUser
+}
+
+// TemplateUser is the user information available to templates.
+type TemplateUser struct {
+	GID      string
+	HomeDir  string
+	Name     string
+	UID      string
+	Username string
+}
+
+// DataExecutor is an Executor that can be supplied a data context.
+type DataExecutor interface {
+	Executor
+	// WithData returns an Executor that will supply data to the templates it
+	// executes.
+	WithData(data *TemplateData) Executor
+}
+
+// NewTemplateData returns a TemplateData populated from the environment, with
+// the supplied path, and with a read-only copy of cfg.
+func NewTemplateData(path string, cfg any) (*TemplateData, error) {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Logger.Trace().Err(err).Msg("hostname not available to templates")
+	}
+
+	var tmplUser TemplateUser
+	u, err := user.Current()
+	if err != nil {
+		log.Logger.Trace().Err(err).Msg("user not available to templates")
+	} else {
+		tmplUser = TemplateUser{
+			GID:      u.Gid,
+			HomeDir:  u.HomeDir,
+			Name:     u.Name,
+			UID:      u.Uid,
+			Username: u.Username,
+		}
+	}
+
+	view, err := configView(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateData{
+		Config:   view,
+		Env:      env,
+		Hostname: hostname,
+		Path:     path,
+		User:     tmplUser,
+	}, nil
+}
+
+// configView returns a copy of cfg using the same key names found in the
+// config files.
+func configView(cfg any) (map[string]any, error) {
+	view := map[string]any{}
+	if cfg == nil {
+		return view, nil
+	}
+
+	b, err := yaml.Marshal(RevealSecrets(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("marshal config view: %w", err)
+	}
+
+	err = yaml.Unmarshal(b, &view)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal config view: %w", err)
+	}
+	if view == nil {
+		view = map[string]any{}
+	}
+	return view, nil
+}
+
+// templateExecutor returns the executor for cfg, supplying it a data context
+// if it supports one.
+func templateExecutor[T any](ctx context.Context, executor Executor, cfg *T) (Executor, error) {
+	dataExecutor, ok := executor.(DataExecutor)
+	if !ok {
+		return executor, nil
+	}
+
+	data, err := NewTemplateData(SourcePath(ctx), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := executor.(*Template); ok {
+		return t.withData(data).withSecretCache(lookupSourceContext(ctx).load.secretCache()), nil
+	}
+	return dataExecutor.WithData(data), nil
+}
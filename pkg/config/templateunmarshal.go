@@ -0,0 +1,212 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// lineMarker is injected after every newline of the template text so that
+// lines of the rendered output can be mapped back to the template line that
+// produced them.
+const lineMarker = "\x00configloader-line:"
+
+var renderedLineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// TemplateLineError is returned by TemplateUnmarshal when the rendered output
+// fails to unmarshal. Line is the line of the template that produced the
+// failing line of output.
+type TemplateLineError struct {
+	Line         int
+	RenderedLine int
+	Err          error
+}
+
+func (e *TemplateLineError) Error() string {
+	return fmt.Sprintf("template line %d (rendered line %d): %s", e.Line, e.RenderedLine, e.Err)
+}
+
+func (e *TemplateLineError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateUnmarshal is an Unmarshal function that renders the entire file
+// through the go template engine, then hands the output to the supplied
+// unmarshal function (YamlUnmarshal if nil). Unlike YamlValueTemplateUnmarshal
+// this allows for actions like `{{range}}` and `{{if}}` to generate structure.
+// If the rendered output fails to unmarshal, the error will be a
+// TemplateLineError identifying the template line responsible.
+func TemplateUnmarshal[T any](
+	tmpl *Template,
+	unmarshal func(ctx context.Context, b []byte, cfg *T) error,
+) func(ctx context.Context, b []byte, cfg *T) error {
+	return func(ctx context.Context, b []byte, cfg *T) error {
+		if tmpl == nil {
+			tmpl = newDefaultTemplate()
+		}
+		if unmarshal == nil {
+			unmarshal = withoutContext(YamlUnmarshal[T]())
+		}
+
+		data, err := NewTemplateData(SourcePath(ctx), cfg)
+		if err != nil {
+			return fmt.Errorf("templateunmarshal data: %w", err)
+		}
+
+		name := data.Path
+		if name == "" {
+			name = "config"
+		}
+
+		rendered, lines, err := tmpl.withData(data).
+			withSecretCache(lookupSourceContext(ctx).load.secretCache()).
+			render(name, string(b))
+		if err != nil {
+			return fmt.Errorf("templateunmarshal: %w", err)
+		}
+
+		err = unmarshal(ctx, rendered, cfg)
+		if err != nil {
+			renderedLine := errorLine(rendered, err)
+			if renderedLine > 0 && renderedLine <= len(lines) {
+				err = &TemplateLineError{
+					Line:         lines[renderedLine-1],
+					RenderedLine: renderedLine,
+					Err:          err,
+				}
+			}
+			return fmt.Errorf("templateunmarshal: %w", err)
+		}
+		return nil
+	}
+}
+
+// render executes text as a template and returns the output along with the
+// template line responsible for each line of output.
+func (t *Template) render(name string, text string) ([]byte, []int, error) {
+	tmpl, err := t.cache.file(text, func(tmpl *template.Template) {
+		for _, tmpl := range tmpl.Templates() {
+			if tmpl.Tree != nil {
+				annotateLines(tmpl.Root, text)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("new template %s: %w", name, err)
+	}
+	tmpl, err = t.withSecretFuncs(tmpl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, t.templateData())
+	if err != nil {
+		return nil, nil, fmt.Errorf("execute template %s: %w", name, err)
+	}
+
+	rendered, lines := stripLineMarkers(stripResultMarkers(out.String()))
+	return []byte(rendered), lines, nil
+}
+
+func annotateLines(node parse.Node, text string) {
+	switch typed := node.(type) {
+	case *parse.ListNode:
+		if typed == nil {
+			return
+		}
+		for _, n := range typed.Nodes {
+			annotateLines(n, text)
+		}
+	case *parse.IfNode:
+		annotateLines(typed.List, text)
+		annotateLines(typed.ElseList, text)
+	case *parse.RangeNode:
+		annotateLines(typed.List, text)
+		annotateLines(typed.ElseList, text)
+	case *parse.WithNode:
+		annotateLines(typed.List, text)
+		annotateLines(typed.ElseList, text)
+	case *parse.TextNode:
+		pos := int(typed.Pos)
+		if pos > len(text) {
+			return
+		}
+		line := 1 + strings.Count(text[:pos], "\n")
+
+		var b bytes.Buffer
+		for _, c := range typed.Text {
+			b.WriteByte(c)
+			if c == '\n' {
+				line++
+				b.WriteString(lineMarker)
+				b.WriteString(strconv.Itoa(line))
+				b.WriteByte(0)
+			}
+		}
+		typed.Text = b.Bytes()
+	}
+}
+
+func stripLineMarkers(out string) (string, []int) {
+	renderedLines := strings.Split(out, "\n")
+	lines := make([]int, len(renderedLines))
+	current := 1
+	for i, line := range renderedLines {
+		for {
+			start := strings.Index(line, lineMarker)
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(line[start+len(lineMarker):], 0)
+			if end < 0 {
+				break
+			}
+			end += start + len(lineMarker)
+			if n, err := strconv.Atoi(line[start+len(lineMarker) : end]); err == nil {
+				current = n
+			}
+			line = line[:start] + line[end+1:]
+		}
+		renderedLines[i] = line
+		lines[i] = current
+	}
+	return strings.Join(renderedLines, "\n"), lines
+}
+
+// errorLine makes a best effort attempt at determining which line of data
+// caused err.
+func errorLine(data []byte, err error) int {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return offsetLine(data, syntaxErr.Offset)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return offsetLine(data, typeErr.Offset)
+	}
+
+	match := renderedLineRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func offsetLine(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return 1 + bytes.Count(data[:offset], []byte("\n"))
+}
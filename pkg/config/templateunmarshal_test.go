@@ -0,0 +1,130 @@
+//nolint:goconst // explicit strings have explanatory value in tests
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateUnmarshal(t *testing.T) {
+	tmpl := config.NewTemplate(template.FuncMap{
+		"hosts": func() []string { return []string{"a.example.com", "b.example.com"} },
+		"split": strings.Split,
+	})
+
+	t.Run("range", func(t *testing.T) {
+		var actual map[string]any
+		err := config.TemplateUnmarshal[map[string]any](tmpl, nil)(
+			context.Background(),
+			[]byte(`---
+hosts:
+{{- range hosts }}
+- name: {{ . }}
+  port: 443
+{{- end }}
+`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t,
+			map[string]any{
+				"hosts": []any{
+					map[string]any{"name": "a.example.com", "port": 443},
+					map[string]any{"name": "b.example.com", "port": 443},
+				},
+			},
+			actual)
+	})
+
+	t.Run("if", func(t *testing.T) {
+		var actual map[string]any
+		err := config.TemplateUnmarshal[map[string]any](tmpl, nil)(
+			context.Background(),
+			[]byte(`---
+{{- if eq (len hosts) 2 }}
+cluster:
+  enabled: true
+{{- else }}
+single: true
+{{- end }}
+`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"cluster": map[string]any{"enabled": true}}, actual)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var actual map[string]any
+		err := config.TemplateUnmarshal(
+			tmpl,
+			func(_ context.Context, b []byte, cfg *map[string]any) error {
+				return json.Unmarshal(b, cfg)
+			})(
+			context.Background(),
+			[]byte(`{
+  "hosts": [{{ range $i, $h := hosts }}{{ if $i }}, {{ end }}"{{ $h }}"{{ end }}]
+}`),
+			&actual)
+		require.NoError(t, err)
+		require.Equal(t, map[string]any{"hosts": []any{"a.example.com", "b.example.com"}}, actual)
+	})
+
+	t.Run("yaml error line", func(t *testing.T) {
+		var actual map[string]any
+		err := config.TemplateUnmarshal[map[string]any](tmpl, nil)(
+			context.Background(),
+			[]byte(`---
+hosts:
+{{- range hosts }}
+- {{ . }}
+{{- end }}
+bad: [
+`),
+			&actual)
+		var lineErr *config.TemplateLineError
+		require.True(t, errors.As(err, &lineErr), "%v", err)
+		require.Equal(t, 6, lineErr.Line)
+		require.Equal(t, 5, lineErr.RenderedLine)
+	})
+
+	t.Run("json error line", func(t *testing.T) {
+		var actual map[string]any
+		err := config.TemplateUnmarshal(
+			tmpl,
+			func(_ context.Context, b []byte, cfg *map[string]any) error {
+				return json.Unmarshal(b, cfg)
+			})(
+			context.Background(),
+			[]byte(`{
+  "hosts": [
+{{- range $i, $h := split "a,b,c" "," }}
+    {{ if $i }},{{ end }}"{{ $h }}"
+{{- end }}
+  ],
+  "bad": ,
+}`),
+			&actual)
+		var lineErr *config.TemplateLineError
+		require.True(t, errors.As(err, &lineErr), "%v", err)
+		require.Equal(t, 7, lineErr.Line)
+		require.Equal(t, 7, lineErr.RenderedLine)
+	})
+
+	t.Run("execute error", func(t *testing.T) {
+		var actual map[string]any
+		err := config.TemplateUnmarshal[map[string]any](tmpl, nil)(
+			context.Background(),
+			[]byte(`---
+a: b
+c: {{ undefined }}
+`),
+			&actual)
+		require.ErrorContains(t, err, `config:3: function "undefined" not defined`)
+	})
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// VaultSource is a vault kv secret to load. The fields of the secret are
+// loaded under Key, allowing an entire secret to be loaded as a subtree of
+// the config. A secret that does not exist is skipped, unless the kv version of
+// its mount could not be determined, as vault cannot then tell it is missing.
+type VaultSource[T any] struct {
+	// Client used to read the secret. If not specified vault.New() will be
+	// used.
+	Client *vault.Client
+	// Key is the dot separated path (ie: `database.credentials`) under which
+	// the fields of the secret are loaded. If not specified the fields are
+	// loaded at the root of the config.
+	Key  string
+	Path string
+	// Unmarshal is the function to unmarshal the (yaml encoded) secret into
+	// the cfg object. If not specified ExtensionUnmarshal(YamlUnmarshal) will
+	// be used, which unmarshals it as yaml as it has no extension.
+	Unmarshal func(b []byte, cfg *T) error
+	// UnmarshalContext, if specified, is used in place of Unmarshal and is
+	// passed the ctx of LoadContext (see ContextSourceLoader).
+	UnmarshalContext func(ctx context.Context, b []byte, cfg *T) error
+}
+
+func (s VaultSource[T]) Load(cfg *T) error {
+	return s.LoadContext(context.Background(), cfg)
+}
+
+func (s VaultSource[T]) LoadContext(ctx context.Context, cfg *T) error {
+	client := s.Client
+	if client == nil {
+		client = vault.New()
+	}
+
+	data, err := client.Data(s.Path)
+	if errors.Is(err, vault.ErrNotFound) {
+		log.Logger.Debug().Str("path", s.Path).Msg("vault secret not found")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("load from vault: %w", err)
+	}
+
+	var subtree any = data
+	if s.Key != "" {
+		keys := strings.Split(s.Key, ".")
+		for _, key := range slices.Backward(keys) {
+			subtree = map[string]any{key: subtree}
+		}
+	}
+
+	b, err := yaml.Marshal(subtree)
+	if err != nil {
+		return fmt.Errorf("load from vault marshal: %w", err)
+	}
+
+	err = unmarshal(ctx, "", b, cfg, s.Unmarshal, s.UnmarshalContext)
+	if err != nil {
+		return fmt.Errorf("load from vault: %w", err)
+	}
+
+	log.Logger.Debug().Str("path", s.Path).Msg("loaded vaultsource config")
+	return nil
+}
+
+func (s VaultSource[T]) String() string {
+	return fmt.Sprintf("vaultsource:%s", s.Path)
+}
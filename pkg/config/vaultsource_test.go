@@ -0,0 +1,63 @@
+package config_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/pastdev/configloader/pkg/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/kv/myapp/db":
+			fmt.Fprint(w, `{"data": {"password": "pass", "port": 5432, "username": "user"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors": []}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := vault.NewClient(&vault.API{Address: server.URL, KVVersion: 1})
+
+	type Database struct {
+		Host     string `yaml:"host"`
+		Password string `yaml:"password"`
+		Port     int    `yaml:"port"`
+		Username string `yaml:"username"`
+	}
+	type Config struct {
+		Database struct {
+			Primary Database `yaml:"primary"`
+		} `yaml:"database"`
+	}
+
+	var cfg Config
+	err := config.Sources[Config]{
+		config.RawSource[Config]{Data: []byte(`{database: {primary: {host: db.example.org, port: 3306}}}`)},
+		config.VaultSource[Config]{Client: client, Key: "database.primary", Path: "kv/myapp/db"},
+		config.VaultSource[Config]{Client: client, Key: "database.primary", Path: "kv/myapp/missing"},
+	}.Load(&cfg)
+	require.NoError(t, err)
+
+	var expected Config
+	expected.Database.Primary = Database{
+		Host:     "db.example.org",
+		Password: "pass",
+		Port:     5432,
+		Username: "user",
+	}
+	require.Equal(t, expected, cfg)
+
+	// without a kv version, a missing secret cannot be told apart from a v2
+	// secret read as v1
+	unknown := vault.NewClient(&vault.API{Address: server.URL})
+	err = config.Sources[Config]{
+		config.VaultSource[Config]{Client: unknown, Path: "kv/myapp/missing"},
+	}.Load(&cfg)
+	require.ErrorContains(t, err, "kv version of mount kv/ is unknown")
+}
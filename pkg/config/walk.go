@@ -0,0 +1,372 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrKeyCollision is returned by Walk when templated keys render to the same
+// value as another key in the same map.
+var ErrKeyCollision = errors.New("key collision")
+
+// WalkOption configures Walk.
+type WalkOption func(*walkOptions)
+
+type walkOptions struct {
+	keys bool
+	// keyCallback, if set, is used in place of the callback for keys
+	keyCallback Executor
+}
+
+// WithKeys will also pass the string map keys to the executor allowing them to
+// be templated. Keys are kept as the rendered string, they are not interpreted
+// as values are (see Template.Execute). If a rendered key collides with
+// another key in the same map an ErrKeyCollision error is returned.
+func WithKeys() WalkOption {
+	return func(o *walkOptions) {
+		o.keys = true
+	}
+}
+
+// withKeyExecutor will use callback to execute keys rather than the callback
+// supplied to Walk.
+func withKeyExecutor(callback Executor) WalkOption {
+	return func(o *walkOptions) {
+		o.keyCallback = callback
+	}
+}
+
+// Walk will recursively iterate over all the nodes of data calling callback
+// for each node. In addition to the generic maps and slices produced by
+// unmarshaling into `any`, Walk will use reflection to descend into structs,
+// pointers, typed maps and typed slices. This allows Walk to be applied to an
+// already decoded config (ie: `Walk(executor, &cfg)`), in which case the
+// results of callback are assigned back into cfg, converting them to the type
+// of the field if necessary. Struct fields are named using their yaml key and
+// the values of Secrets are walked as if they were not wrapped.
+func Walk(callback Executor, data any, opts ...WalkOption) error {
+	var options walkOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	_, err := walk(callback, data, []string{}, &options)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (o *walkOptions) keyExecutor(callback Executor) Executor {
+	if o.keyCallback != nil {
+		return o.keyCallback
+	}
+	return callback
+}
+
+func walk(callback Executor, node any, keyStack []string, options *walkOptions) (any, error) {
+	switch typed := node.(type) {
+	case map[string]any:
+		// json deserialized
+		if options.keys {
+			err := walkMapKeys(options.keyExecutor(callback), reflect.ValueOf(typed), keyStack)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for k, v := range typed {
+			keyStack := append(keyStack, fmt.Sprintf("%v", k))
+			newValue, err := walk(callback, v, keyStack, options)
+			if err != nil {
+				return nil, fmt.Errorf("walk array: %w", err)
+			}
+			typed[k] = newValue
+		}
+		return typed, nil
+	case map[any]any:
+		// yaml deserialized
+		if options.keys {
+			err := walkMapKeys(options.keyExecutor(callback), reflect.ValueOf(typed), keyStack)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for k, v := range typed {
+			keyStack := append(keyStack, fmt.Sprintf("%v", k))
+			newValue, err := walk(callback, v, keyStack, options)
+			if err != nil {
+				return nil, fmt.Errorf("walk array: %w", err)
+			}
+			typed[k] = newValue
+		}
+		return typed, nil
+	case []any:
+		for i, j := range typed {
+			keyStack := append(keyStack, strconv.Itoa(i))
+			newValue, err := walk(callback, j, keyStack, options)
+			if err != nil {
+				return nil, fmt.Errorf("walk array: %w", err)
+			}
+			typed[i] = newValue
+		}
+		return typed, nil
+	}
+
+	rv := reflect.ValueOf(node)
+	//nolint:exhaustive // all other kinds are treated as leaf values
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		// reference types can be updated in place
+		if rv.IsNil() {
+			return node, nil
+		}
+		err := walkValue(callback, rv, keyStack, options)
+		if err != nil {
+			return nil, err
+		}
+		return node, nil
+	case reflect.Struct, reflect.Array:
+		// values must be copied to be addressable
+		copied := reflect.New(rv.Type()).Elem()
+		copied.Set(rv)
+		err := walkValue(callback, copied, keyStack, options)
+		if err != nil {
+			return nil, err
+		}
+		return copied.Interface(), nil
+	default:
+		v, err := callback.Execute(fmt.Sprintf("/%s", strings.Join(keyStack, "/")), node)
+		if err != nil {
+			return nil, fmt.Errorf("execute template: %w", err)
+		}
+		return v, nil
+	}
+}
+
+// walkValue walks v updating it in place. v must be settable unless it is a
+// map, pointer or slice.
+func walkValue(callback Executor, v reflect.Value, keyStack []string, options *walkOptions) error {
+	//nolint:exhaustive // all other kinds are treated as leaf values
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		newValue, err := walk(callback, v.Elem().Interface(), keyStack, options)
+		if err != nil {
+			return err
+		}
+		return setValue(v, newValue)
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return walkValue(callback, v.Elem(), keyStack, options)
+	case reflect.Struct:
+		if v.CanAddr() {
+			if s, ok := v.Addr().Interface().(secret); ok {
+				return walkValue(callback, s.secretValue(), keyStack, options)
+			}
+		}
+		t := v.Type()
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, inline, skip := yamlFieldName(field)
+			if skip {
+				continue
+			}
+			fieldStack := keyStack
+			if !inline {
+				fieldStack = append(keyStack, name)
+			}
+			err := walkValue(callback, v.Field(i), fieldStack, options)
+			if err != nil {
+				return fmt.Errorf("walk struct: %w", err)
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		if options.keys {
+			err := walkMapKeys(options.keyExecutor(callback), v, keyStack)
+			if err != nil {
+				return err
+			}
+		}
+		for _, k := range v.MapKeys() {
+			keyStack := append(keyStack, fmt.Sprintf("%v", k.Interface()))
+			// map values are not addressable so walk a copy
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(k))
+			err := walkValue(callback, value, keyStack, options)
+			if err != nil {
+				return fmt.Errorf("walk map: %w", err)
+			}
+			v.SetMapIndex(k, value)
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			keyStack := append(keyStack, strconv.Itoa(i))
+			err := walkValue(callback, v.Index(i), keyStack, options)
+			if err != nil {
+				return fmt.Errorf("walk array: %w", err)
+			}
+		}
+		return nil
+	default:
+		if !v.CanInterface() {
+			return nil
+		}
+		newValue, err := callback.Execute(fmt.Sprintf("/%s", strings.Join(keyStack, "/")), v.Interface())
+		if err != nil {
+			return fmt.Errorf("execute template: %w", err)
+		}
+		return setValue(v, newValue)
+	}
+}
+
+// setValue assigns value to v converting it to the type of v if necessary.
+func setValue(v reflect.Value, value any) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Type().AssignableTo(v.Type()) {
+		v.Set(rv)
+		return nil
+	}
+
+	if v.Kind() == reflect.String {
+		if _, ok := value.(string); ok || rv.Kind() != reflect.Map && rv.Kind() != reflect.Slice {
+			v.SetString(fmt.Sprintf("%v", value))
+			return nil
+		}
+	}
+
+	// fall back to the same conversion that would have happened had the
+	// value been unmarshaled from yaml
+	b, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal %T for %s: %w", value, v.Type(), err)
+	}
+	converted := reflect.New(v.Type())
+	err = yaml.Unmarshal(b, converted.Interface())
+	if err != nil {
+		return fmt.Errorf("convert %T to %s: %w", value, v.Type(), err)
+	}
+	v.Set(converted.Elem())
+	return nil
+}
+
+// yamlFieldName returns the key yaml would use for field.
+func yamlFieldName(field reflect.StructField) (string, bool, bool) {
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, flags, _ := strings.Cut(tag, ",")
+	inline := slices.Contains(strings.Split(flags, ","), "inline")
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, inline, false
+}
+
+// keyExecutor is implemented by executors that render map keys. Keys are
+// always rendered as strings, without the interpretation applied to values
+// (ie: a key rendering `1.0` or `null` is kept as is). Executors that do not
+// implement it must return a string from Execute for each key.
+type keyExecutor interface {
+	executeKey(name string, key string) (string, error)
+}
+
+// walkMapKeys calls callback for each string key of the map v, replacing the
+// keys that render to a different value.
+func walkMapKeys(callback Executor, v reflect.Value, keyStack []string) error {
+	keyType := v.Type().Key()
+	if keyType.Kind() != reflect.String && keyType.Kind() != reflect.Interface {
+		return nil
+	}
+
+	keys := v.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return strings.Compare(fmt.Sprintf("%v", a.Interface()), fmt.Sprintf("%v", b.Interface()))
+	})
+
+	type rename struct {
+		from reflect.Value
+		to   string
+	}
+	var renames []rename
+	owners := make(map[string]string, len(keys))
+	for _, k := range keys {
+		name := fmt.Sprintf("%v", k.Interface())
+		keyStack := append(keyStack, name)
+		rendered := name
+		if k.Kind() == reflect.String || k.Kind() == reflect.Interface && k.Elem().Kind() == reflect.String {
+			var err error
+			rendered, err = executeKey(callback, fmt.Sprintf("/%s", strings.Join(keyStack, "/")), name)
+			if err != nil {
+				return fmt.Errorf("execute key template: %w", err)
+			}
+		}
+
+		if owner, ok := owners[rendered]; ok {
+			return fmt.Errorf(
+				"%w: /%s: %q and %q both render to %q",
+				ErrKeyCollision,
+				strings.Join(keyStack[:len(keyStack)-1], "/"),
+				owner,
+				name,
+				rendered)
+		}
+		owners[rendered] = name
+
+		if rendered != name {
+			renames = append(renames, rename{from: k, to: rendered})
+		}
+	}
+
+	// remove all renamed keys before adding any back as a key may be renamed
+	// to the original name of another key
+	values := make([]reflect.Value, len(renames))
+	for i, r := range renames {
+		values[i] = v.MapIndex(r.from)
+		v.SetMapIndex(r.from, reflect.Value{})
+	}
+	for i, r := range renames {
+		v.SetMapIndex(reflect.ValueOf(r.to).Convert(keyType), values[i])
+	}
+	return nil
+}
+
+// executeKey renders key using callback.
+func executeKey(callback Executor, name string, key string) (string, error) {
+	if k, ok := callback.(keyExecutor); ok {
+		return k.executeKey(name, key) //nolint:wrapcheck // wrapped by walkMapKeys
+	}
+
+	v, err := callback.Execute(name, key)
+	if err != nil {
+		return "", err //nolint:wrapcheck // wrapped by walkMapKeys
+	}
+	rendered, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s rendered %T rather than a string", name, v)
+	}
+	return rendered, nil
+}
@@ -0,0 +1,123 @@
+//nolint:goconst // explicit strings have explanatory value in tests
+package config_test
+
+import (
+	"fmt"
+	"testing"
+	"text/template"
+
+	"github.com/pastdev/configloader/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingExecutor struct {
+	executor config.Executor
+	names    []string
+}
+
+func (r *recordingExecutor) Execute(name string, value any) (any, error) {
+	if s, ok := value.(string); ok && s != "" {
+		r.names = append(r.names, name)
+	}
+	//nolint:wrapcheck // test passthrough
+	return r.executor.Execute(name, value)
+}
+
+func TestWalkTyped(t *testing.T) {
+	tmpl := config.NewTemplate(template.FuncMap{
+		"password": func(id string) string { return fmt.Sprintf("pass-for-%s", id) },
+		"port":     func() int { return 8443 },
+	})
+
+	type Creds struct {
+		Password string `yaml:"password"`
+		Username string `yaml:"username"`
+	}
+
+	type Embedded struct {
+		Region string `yaml:"region"`
+	}
+
+	type Config struct {
+		Embedded `yaml:",inline"`
+		Creds    *Creds            `yaml:"creds"`
+		Hosts    []string          `yaml:"hosts"`
+		Ignored  string            `yaml:"-"`
+		Labels   map[string]string `yaml:"labels"`
+		Other    map[string]any    `yaml:"other"`
+		Port     int               `yaml:"port"`
+		Servers  []Creds           `yaml:"servers"`
+		private  string
+	}
+
+	t.Run("struct", func(t *testing.T) {
+		cfg := Config{
+			Embedded: Embedded{Region: `{{ "us-east-1" }}`},
+			Creds:    &Creds{Password: `{{ password "a" }}`, Username: "user"},
+			Hosts:    []string{`{{ "a.example.com" }}`, "b.example.com"},
+			Ignored:  `{{ password "ignored" }}`,
+			Labels:   map[string]string{"env": `{{ "prod" }}`},
+			Other:    map[string]any{"nested": []any{`{{ password "b" }}`}},
+			Port:     0,
+			Servers:  []Creds{{Password: `{{ password "c" }}`}},
+			private:  `{{ password "private" }}`,
+		}
+
+		recorder := &recordingExecutor{executor: tmpl}
+		err := config.Walk(recorder, &cfg)
+		require.NoError(t, err)
+		require.Equal(t,
+			Config{
+				Embedded: Embedded{Region: "us-east-1"},
+				Creds:    &Creds{Password: "pass-for-a", Username: "user"},
+				Hosts:    []string{"a.example.com", "b.example.com"},
+				Ignored:  `{{ password "ignored" }}`,
+				Labels:   map[string]string{"env": "prod"},
+				Other:    map[string]any{"nested": []any{"pass-for-b"}},
+				Port:     0,
+				Servers:  []Creds{{Password: "pass-for-c"}},
+				private:  `{{ password "private" }}`,
+			},
+			cfg)
+		require.ElementsMatch(t,
+			[]string{
+				"/region",
+				"/creds/password",
+				"/creds/username",
+				"/hosts/0",
+				"/hosts/1",
+				"/labels/env",
+				"/other/nested/0",
+				"/servers/0/password",
+			},
+			recorder.names)
+	})
+
+	t.Run("conversion", func(t *testing.T) {
+		type Templated struct {
+			Port     any `yaml:"port"`
+			PortText any `yaml:"port_text"`
+		}
+
+		// any typed fields take on the type of the result
+		templated := Templated{Port: `{{ port }}`, PortText: `{{ port | raw }}`}
+		err := config.Walk(tmpl, &templated)
+		require.NoError(t, err)
+		require.Equal(t, Templated{Port: float64(8443), PortText: "8443"}, templated)
+
+		// typed fields are converted
+		converted := map[string]string{"port": `{{ port }}`}
+		err = config.Walk(tmpl, converted)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"port": "8443"}, converted)
+	})
+
+	t.Run("typed map keys", func(t *testing.T) {
+		cfg := map[string]Creds{
+			`{{ "host" }}`: {Password: `{{ password "a" }}`},
+		}
+		err := config.Walk(tmpl, cfg, config.WithKeys())
+		require.NoError(t, err)
+		require.Equal(t, map[string]Creds{"host": {Password: "pass-for-a"}}, cfg)
+	})
+}
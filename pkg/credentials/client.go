@@ -0,0 +1,98 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// Client reads the credentials systemd provides to services using
+// `LoadCredential=` from $CREDENTIALS_DIRECTORY.
+type Client struct{}
+
+var _ secrets.FuncProvider = Client{}
+
+func (c Client) AddFuncs(funcs map[string]any) {
+	funcs["credential"] = c.Get
+	funcs["secretFile"] = ReadFile
+}
+
+// Check implements [secrets.Provider].
+func (Client) Check() error {
+	if os.Getenv("CREDENTIALS_DIRECTORY") == "" {
+		return errors.New("CREDENTIALS_DIRECTORY not set, use LoadCredential= in the systemd unit")
+	}
+	return nil
+}
+
+// Get implements [secrets.Provider] returning the content of the named
+// credential in $CREDENTIALS_DIRECTORY. It is available to templates as:
+//
+//	password: '{{ credential "db-password" }}'
+func (c Client) Get(name string) (string, error) {
+	err := c.Check()
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsLocal(name) || strings.ContainsRune(name, filepath.Separator) {
+		return "", fmt.Errorf("invalid credential name: %s", name)
+	}
+	return ReadFile(filepath.Join(os.Getenv("CREDENTIALS_DIRECTORY"), name))
+}
+
+// GetField implements [secrets.Provider]. Credentials do not have fields.
+func (Client) GetField(_ string, _ string) (string, error) {
+	return "", fmt.Errorf("credential fields: %w", secrets.ErrNotSupported)
+}
+
+// List implements [secrets.Provider] returning the names of the credentials in
+// $CREDENTIALS_DIRECTORY.
+func (c Client) List() ([]string, error) {
+	err := c.Check()
+	if err != nil {
+		return nil, err
+	}
+	listing, err := os.ReadDir(os.Getenv("CREDENTIALS_DIRECTORY"))
+	if err != nil {
+		return nil, fmt.Errorf("list credentials: %w", err)
+	}
+	names := make([]string, 0, len(listing))
+	for _, entry := range listing {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// ReadFile returns the content, less any trailing newline, of the file at
+// path (ie: a docker secret at /run/secrets/db-password). A leading `~/` is
+// expanded to the home directory. It is available to templates as:
+//
+//	password: '{{ secretFile "/run/secrets/db-password" }}'
+func ReadFile(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			log.Logger.Trace().Err(err).Msg("User home directory not defined")
+		} else {
+			path = filepath.Join(homeDir, path[1:])
+		}
+	}
+
+	//nolint:gosec // intent is to allow user specified secret files
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r"), nil
+}
+
+func New() *Client {
+	return &Client{}
+}
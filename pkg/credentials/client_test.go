@@ -0,0 +1,62 @@
+package credentials_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/credentials"
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	write("database.password", "pass\n")
+	write("database.port", "0123\r\n")
+	write(".hidden", "ignored")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0o700))
+	client := credentials.New()
+
+	t.Run("get", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", dir)
+		actual, err := client.Get("database.password")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+
+		_, err = client.Get("../escape")
+		require.ErrorContains(t, err, "invalid credential name")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", dir)
+		actual, err := client.List()
+		require.NoError(t, err)
+		require.Equal(t, []string{"database.password", "database.port"}, actual)
+	})
+
+	t.Run("field not supported", func(t *testing.T) {
+		_, err := client.GetField("database.password", "x")
+		require.ErrorIs(t, err, secrets.ErrNotSupported)
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		t.Setenv("CREDENTIALS_DIRECTORY", "")
+		_, err := client.Get("database.password")
+		require.ErrorContains(t, err, "CREDENTIALS_DIRECTORY not set")
+	})
+
+	t.Run("read file", func(t *testing.T) {
+		actual, err := credentials.ReadFile(filepath.Join(dir, "database.port"))
+		require.NoError(t, err)
+		require.Equal(t, "0123", actual)
+
+		t.Setenv("HOME", dir)
+		actual, err = credentials.ReadFile("~/database.password")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+}
@@ -0,0 +1,275 @@
+package keepass
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// Client reads entries from a keepass database. Entries are identified by
+// their path in the database (ie: `web/example.org`).
+type Client struct {
+	// Attachment returns the content of the named attachment of the entry.
+	Attachment func(entry string, name string) ([]byte, error)
+	// ListIDs returns the paths of all entries.
+	ListIDs func() ([]string, error)
+	// Lookup returns the value of the attribute of the entry.
+	Lookup func(entry string, attribute string) ([]byte, error)
+	// Status returns an error if the database cannot be opened.
+	Status func() error
+}
+
+// CLI uses keepassxc-cli to read a database.
+type CLI struct {
+	Database string
+	// KeyFile, if set, is used along with the password to unlock Database.
+	KeyFile string
+	// Password returns the password for Database. If nil, Database is
+	// opened without a password (ie: using KeyFile alone).
+	Password func() (string, error)
+}
+
+// Registry is the subset of *secrets.Registry used to obtain the database
+// password from another provider.
+type Registry interface {
+	Secret(provider string, id string, field ...string) (string, error)
+}
+
+var (
+	_ secrets.CachingProvider = Client{}
+	_ secrets.FuncProvider    = Client{}
+)
+
+func (c Client) AddFuncs(funcs map[string]any) {
+	funcs["keepass"] = c.Get
+	funcs["keepassAttachment"] = c.GetAttachment
+	funcs["keepassField"] = c.GetField
+	funcs["keepassFormat"] = c.GetFormat
+}
+
+// Check implements [secrets.Provider].
+func (c Client) Check() error {
+	if c.Status == nil {
+		return nil
+	}
+	return c.Status()
+}
+
+// Get implements [secrets.Provider] returning the password of the entry.
+func (c Client) Get(id string) (string, error) {
+	return c.GetField(id, "password")
+}
+
+// GetAttachment returns the content of the named attachment of the entry.
+func (c Client) GetAttachment(id string, name string) (string, error) {
+	if c.Attachment == nil {
+		return "", fmt.Errorf("keepass attachment: %w", secrets.ErrNotSupported)
+	}
+	data, err := c.Attachment(id, name)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetField implements [secrets.Provider] returning the named attribute of the
+// entry. The standard attributes may be named in lower case (ie: password,
+// username), custom attributes must be named exactly.
+func (c Client) GetField(id string, name string) (string, error) {
+	data, err := c.Lookup(id, attributeName(name))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetFormat returns format populated with the attributes in name of the
+// entry.
+func (c Client) GetFormat(id string, format string, name ...string) (string, error) {
+	formatArgs := make([]any, len(name))
+	for i, n := range name {
+		v, err := c.GetField(id, n)
+		if err != nil {
+			return "", err
+		}
+		formatArgs[i] = v
+	}
+
+	return fmt.Sprintf(format, formatArgs...), nil
+}
+
+// List implements [secrets.Provider].
+func (c Client) List() ([]string, error) {
+	if c.ListIDs == nil {
+		return nil, fmt.Errorf("list keepass: %w", secrets.ErrNotSupported)
+	}
+	return c.ListIDs()
+}
+
+// WithCache implements [secrets.CachingProvider].
+func (c Client) WithCache(cache *secrets.Cache) secrets.Provider {
+	// nil functions are left unwrapped so that they are still reported as
+	// not supported
+	if c.Attachment != nil {
+		c.Attachment = cache.WrapField("keepass-attachment", c.Attachment)
+	}
+	if c.Lookup != nil {
+		c.Lookup = cache.WrapField("keepass", c.Lookup)
+	}
+	return c
+}
+
+// attributeName maps the lower case names of the standard attributes to the
+// names used by keepass.
+func attributeName(name string) string {
+	switch name {
+	case "notes":
+		return "Notes"
+	case "password":
+		return "Password"
+	case "title":
+		return "Title"
+	case "url":
+		return "URL"
+	case "username":
+		return "UserName"
+	}
+	return name
+}
+
+// Attachment returns the content of the named attachment of the entry.
+func (c CLI) Attachment(entry string, name string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "keepass").Str("id", entry).Str("attachment", name).Msg("attachment")
+	return c.run("attachment-export", []string{"--stdout"}, entry, name)
+}
+
+// ListIDs returns the paths of all entries.
+func (c CLI) ListIDs() ([]string, error) {
+	log.Logger.Trace().Str("provider", "keepass").Msg("listIDs")
+	stdout, err := c.run("ls", []string{"--recursive", "--flatten"})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, line := range strings.Split(string(stdout), "\n") {
+		// groups end with a / and are listed along with their entries
+		if line == "" || strings.HasSuffix(line, "/") {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	return ids, nil
+}
+
+// Lookup returns the value of the attribute of the entry.
+func (c CLI) Lookup(entry string, attribute string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "keepass").Str("id", entry).Str("attribute", attribute).Msg("show")
+	stdout, err := c.run("show", []string{"--show-protected", "--attributes", attribute}, entry)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(stdout, []byte("\n")), nil
+}
+
+// Status returns an error if the database cannot be opened.
+func (c CLI) Status() error {
+	_, err := c.run("ls", nil)
+	if err != nil {
+		return fmt.Errorf("keepass database %s could not be opened: %w", c.Database, err)
+	}
+	return nil
+}
+
+// run invokes keepassxc-cli command with options followed by the database and
+// args, writing the password to stdin.
+func (c CLI) run(command string, options []string, args ...string) ([]byte, error) {
+	if c.Database == "" {
+		return nil, errors.New("keepass database not configured, set KEEPASS_DATABASE and try again")
+	}
+
+	cliArgs := []string{command, "--quiet"}
+	if c.KeyFile != "" {
+		cliArgs = append(cliArgs, "--key-file", c.KeyFile)
+	}
+
+	var stdin bytes.Buffer
+	if c.Password == nil {
+		cliArgs = append(cliArgs, "--no-password")
+	} else {
+		password, err := c.Password()
+		if err != nil {
+			return nil, fmt.Errorf("keepass password: %w", err)
+		}
+		stdin.WriteString(password + "\n")
+	}
+
+	cliArgs = append(cliArgs, options...)
+	cliArgs = append(cliArgs, c.Database)
+	cliArgs = append(cliArgs, args...)
+
+	cmd := exec.Command("keepassxc-cli", cliArgs...)
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdin = &stdin
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if err != nil {
+		errStr := stderr.String()
+		if strings.Contains(strings.ToLower(errStr), "invalid credentials") {
+			return nil, errors.New("keepass database could not be unlocked, check KEEPASS_PASSWORD and KEEPASS_KEYFILE and try again")
+		}
+		return nil, fmt.Errorf("run keepassxc-cli (%s): %w", errStr, err)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// PasswordFromSecret returns a password function that obtains the password
+// from another provider in registry. The ref is of the form
+// `provider:id[:field]`.
+func PasswordFromSecret(registry Registry, ref string) func() (string, error) {
+	return func() (string, error) {
+		parts := strings.SplitN(ref, ":", 3)
+		if len(parts) < 2 {
+			return "", fmt.Errorf("invalid keepass password secret, expected provider:id[:field]: %s", ref)
+		}
+		//nolint:wrapcheck // registry errors are descriptive
+		return registry.Secret(parts[0], parts[1], parts[2:]...)
+	}
+}
+
+// New returns a client for the database at $KEEPASS_DATABASE, unlocked using
+// the key file at $KEEPASS_KEYFILE and/or the password in $KEEPASS_PASSWORD.
+// If $KEEPASS_PASSWORD is not set, but $KEEPASS_PASSWORD_SECRET is, the
+// password is obtained from registry (see PasswordFromSecret).
+func New(registry Registry) *Client {
+	cli := CLI{
+		Database: os.Getenv("KEEPASS_DATABASE"),
+		KeyFile:  os.Getenv("KEEPASS_KEYFILE"),
+	}
+	if password, ok := os.LookupEnv("KEEPASS_PASSWORD"); ok {
+		cli.Password = func() (string, error) { return password, nil }
+	} else if ref := os.Getenv("KEEPASS_PASSWORD_SECRET"); ref != "" && registry != nil {
+		cli.Password = PasswordFromSecret(registry, ref)
+	}
+	return NewCLI(cli)
+}
+
+// NewCLI returns a client that reads the database using cli.
+func NewCLI(cli CLI) *Client {
+	return &Client{
+		Attachment: func(entry string, name string) ([]byte, error) { return cli.Attachment(entry, name) },
+		ListIDs:    func() ([]string, error) { return cli.ListIDs() },
+		Lookup:     func(entry string, attribute string) ([]byte, error) { return cli.Lookup(entry, attribute) },
+		Status:     func() error { return cli.Status() },
+	}
+}
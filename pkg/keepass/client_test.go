@@ -0,0 +1,155 @@
+package keepass_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/keepass"
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+var entries = map[string]map[string]string{
+	"web/example.org": {
+		"Notes":    "These are some notes",
+		"Password": "pass",
+		"Pin":      "1234",
+		"UserName": "user",
+	},
+}
+
+func staticLookupClient() keepass.Client {
+	return keepass.Client{
+		Lookup: func(entry string, attribute string) ([]byte, error) {
+			v, ok := entries[entry][attribute]
+			if !ok {
+				return nil, fmt.Errorf("no attribute %s in %s", attribute, entry)
+			}
+			return []byte(v), nil
+		},
+	}
+}
+
+func TestProvider(t *testing.T) {
+	client := staticLookupClient()
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := client.Get("web/example.org")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("standard attribute", func(t *testing.T) {
+		actual, err := client.GetField("web/example.org", "username")
+		require.NoError(t, err)
+		require.Equal(t, "user", actual)
+	})
+
+	t.Run("custom attribute", func(t *testing.T) {
+		actual, err := client.GetField("web/example.org", "Pin")
+		require.NoError(t, err)
+		require.Equal(t, "1234", actual)
+	})
+
+	t.Run("format", func(t *testing.T) {
+		actual, err := client.GetFormat("web/example.org", "%s:%s", "username", "password")
+		require.NoError(t, err)
+		require.Equal(t, "user:pass", actual)
+	})
+
+	t.Run("attachment not supported", func(t *testing.T) {
+		_, err := client.GetAttachment("web/example.org", "cert.pem")
+		require.ErrorIs(t, err, secrets.ErrNotSupported)
+
+		cached, ok := client.WithCache(secrets.NewCache()).(keepass.Client)
+		require.True(t, ok)
+		_, err = cached.GetAttachment("web/example.org", "cert.pem")
+		require.ErrorIs(t, err, secrets.ErrNotSupported)
+	})
+
+	t.Run("list not supported", func(t *testing.T) {
+		_, err := client.List()
+		require.ErrorIs(t, err, secrets.ErrNotSupported)
+	})
+}
+
+type staticRegistry map[string]string
+
+func (r staticRegistry) Secret(provider string, id string, field ...string) (string, error) {
+	v, ok := r[strings.Join(append([]string{provider, id}, field...), ":")]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func TestCLI(t *testing.T) {
+	// a stand in for keepassxc-cli that echoes its args and stdin
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(
+		filepath.Join(bin, "keepassxc-cli"),
+		[]byte(`#!/bin/sh
+if [ "$1" = "ls" ]; then
+  printf 'web/\nweb/example.org\nroot entry\n'
+  exit 0
+fi
+read -r password || true
+echo "$* password=$password"
+`),
+		0o700))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	t.Run("password", func(t *testing.T) {
+		client := keepass.NewCLI(keepass.CLI{
+			Database: "db.kdbx",
+			Password: func() (string, error) { return "secret", nil },
+		})
+		actual, err := client.GetField("web/example.org", "username")
+		require.NoError(t, err)
+		require.Equal(t,
+			"show --quiet --show-protected --attributes UserName db.kdbx web/example.org password=secret",
+			actual)
+	})
+
+	t.Run("key file", func(t *testing.T) {
+		client := keepass.NewCLI(keepass.CLI{Database: "db.kdbx", KeyFile: "db.key"})
+		actual, err := client.GetAttachment("web/example.org", "cert.pem")
+		require.NoError(t, err)
+		require.Equal(t,
+			"attachment-export --quiet --key-file db.key --no-password --stdout db.kdbx web/example.org cert.pem password=\n",
+			actual)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("KEEPASS_DATABASE", "env.kdbx")
+		t.Setenv("KEEPASS_PASSWORD_SECRET", "bitwarden:keepass:master")
+		client := keepass.New(staticRegistry{"bitwarden:keepass:master": "from-bitwarden"})
+		actual, err := client.Get("web/example.org")
+		require.NoError(t, err)
+		require.Equal(t,
+			"show --quiet --show-protected --attributes Password env.kdbx web/example.org password=from-bitwarden",
+			actual)
+
+		t.Setenv("KEEPASS_PASSWORD", "from-env")
+		actual, err = keepass.New(nil).Get("web/example.org")
+		require.NoError(t, err)
+		require.Equal(t,
+			"show --quiet --show-protected --attributes Password env.kdbx web/example.org password=from-env",
+			actual)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		ids, err := keepass.NewCLI(keepass.CLI{Database: "db.kdbx"}).List()
+		require.NoError(t, err)
+		require.Equal(t, []string{"web/example.org", "root entry"}, ids)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		err := keepass.NewCLI(keepass.CLI{}).Check()
+		require.ErrorContains(t, err, "set KEEPASS_DATABASE")
+	})
+}
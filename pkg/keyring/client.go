@@ -0,0 +1,88 @@
+package keyring
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// Client reads `user` type keys from the kernel keyring by description (ie:
+// keys added using `keyctl add user myapp-token <secret> @s`).
+type Client struct {
+	// ListIDs returns the descriptions of all keys.
+	ListIDs func() ([]string, error)
+	// Lookup returns the payload of the key with the supplied description.
+	Lookup func(id string) ([]byte, error)
+	// Status returns an error if the keyring is not available.
+	Status func() error
+}
+
+var _ secrets.FuncProvider = Client{}
+
+func (c Client) AddFuncs(funcs map[string]any) {
+	funcs["keyring"] = c.Get
+	funcs["keyringField"] = c.GetField
+}
+
+// Check implements [secrets.Provider].
+func (c Client) Check() error {
+	if c.Status == nil {
+		return nil
+	}
+	return c.Status()
+}
+
+// Get implements [secrets.Provider] returning the payload of the key.
+func (c Client) Get(id string) (string, error) {
+	payload, err := c.Lookup(id)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// GetField implements [secrets.Provider] returning the named field of a key
+// whose payload is a json object. Values that are not strings are json
+// encoded.
+func (c Client) GetField(id string, name string) (string, error) {
+	payload, err := c.Lookup(id)
+	if err != nil {
+		return "", err
+	}
+
+	var fields map[string]any
+	err = json.Unmarshal(payload, &fields)
+	if err != nil {
+		return "", fmt.Errorf("keyring key %s is not a json object: %w", id, err)
+	}
+
+	v, ok := fields[name]
+	if !ok {
+		return "", fmt.Errorf("keyring field not found in %s: %s", id, name)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("marshal keyring field: %w", err)
+	}
+	return string(b), nil
+}
+
+// List implements [secrets.Provider].
+func (c Client) List() ([]string, error) {
+	if c.ListIDs == nil {
+		return nil, fmt.Errorf("list keyring: %w", secrets.ErrNotSupported)
+	}
+	return c.ListIDs()
+}
+
+func New() *Client {
+	return &Client{
+		ListIDs: listIDs,
+		Lookup:  lookup,
+		Status:  status,
+	}
+}
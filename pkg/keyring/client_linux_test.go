@@ -0,0 +1,65 @@
+package keyring_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/keyring"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// addKey adds a user key to the session keyring, skipping the test if the
+// keyring is not available (ie: keyctl is blocked by a container seccomp
+// profile).
+func addKey(t *testing.T, description string, payload string) {
+	t.Helper()
+	serial, err := unix.AddKey("user", description, []byte(payload), unix.KEY_SPEC_SESSION_KEYRING)
+	if err != nil {
+		t.Skipf("session keyring not available: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = unix.KeyctlInt(unix.KEYCTL_UNLINK, serial, unix.KEY_SPEC_SESSION_KEYRING, 0, 0)
+	})
+}
+
+func TestKeyring(t *testing.T) {
+	prefix := fmt.Sprintf("configloader-test-%d-", os.Getpid())
+	addKey(t, prefix+"token", "tok")
+	addKey(t, prefix+"db", `{"password": "pass", "port": 5432}`)
+
+	client := keyring.New()
+	require.NoError(t, client.Check())
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := client.Get(prefix + "token")
+		require.NoError(t, err)
+		require.Equal(t, "tok", actual)
+	})
+
+	t.Run("field", func(t *testing.T) {
+		actual, err := client.GetField(prefix+"db", "password")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+
+		actual, err = client.GetField(prefix+"db", "port")
+		require.NoError(t, err)
+		require.Equal(t, "5432", actual)
+
+		_, err = client.GetField(prefix+"token", "password")
+		require.ErrorContains(t, err, "not a json object")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		ids, err := client.List()
+		require.NoError(t, err)
+		require.Contains(t, ids, prefix+"token")
+		require.Contains(t, ids, prefix+"db")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := client.Get(prefix + "missing")
+		require.ErrorIs(t, err, unix.ENOKEY)
+	})
+}
@@ -0,0 +1,94 @@
+package keyring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"golang.org/x/sys/unix"
+)
+
+// keyrings are searched in order, the session keyring will usually include
+// the user keyring as well, but not always (ie: under sudo or in a container).
+var keyrings = []int{unix.KEY_SPEC_SESSION_KEYRING, unix.KEY_SPEC_USER_KEYRING}
+
+func listIDs() ([]string, error) {
+	log.Logger.Trace().Str("provider", "keyring").Msg("listIDs")
+	seen := map[string]bool{}
+	var ids []string
+	for _, keyring := range keyrings {
+		serials, err := read(keyring)
+		if err != nil {
+			return nil, fmt.Errorf("list keyring: %w", err)
+		}
+
+		for i := 0; i+4 <= len(serials); i += 4 {
+			serial := int(int32(binary.NativeEndian.Uint32(serials[i:])))
+			description, err := unix.KeyctlString(unix.KEYCTL_DESCRIBE, serial)
+			if err != nil {
+				// keys may be revoked or unreadable
+				continue
+			}
+			// type;uid;gid;perm;description
+			parts := strings.SplitN(description, ";", 5)
+			if len(parts) != 5 || parts[0] != "user" || seen[parts[4]] {
+				continue
+			}
+			seen[parts[4]] = true
+			ids = append(ids, parts[4])
+		}
+	}
+	return ids, nil
+}
+
+func lookup(id string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "keyring").Str("id", id).Msg("read")
+	var err error
+	for _, keyring := range keyrings {
+		var serial int
+		serial, err = unix.KeyctlSearch(keyring, "user", id, 0)
+		if err != nil {
+			continue
+		}
+		var payload []byte
+		payload, err = read(serial)
+		if err != nil {
+			return nil, fmt.Errorf("read keyring key %s: %w", id, err)
+		}
+		return payload, nil
+	}
+	if errors.Is(err, unix.ENOKEY) {
+		return nil, fmt.Errorf("keyring key not found, add it using `keyctl add user %s <secret> @s`: %w", id, err)
+	}
+	return nil, fmt.Errorf("search keyring for %s: %w", id, err)
+}
+
+// read returns the payload of the key (or keyring) identified by serial.
+func read(serial int) ([]byte, error) {
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, serial, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("keyctl read: %w", err)
+	}
+	for {
+		buf := make([]byte, size)
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, serial, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("keyctl read: %w", err)
+		}
+		// the payload may have grown since the size was read
+		if n <= size {
+			return buf[:n], nil
+		}
+		size = n
+	}
+}
+
+func status() error {
+	_, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_SESSION_KEYRING, false)
+	if err != nil {
+		return fmt.Errorf("session keyring not available: %w", err)
+	}
+	return nil
+}
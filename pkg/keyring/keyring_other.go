@@ -0,0 +1,21 @@
+//go:build !linux
+
+package keyring
+
+import (
+	"fmt"
+
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+func listIDs() ([]string, error) {
+	return nil, fmt.Errorf("list keyring: %w", secrets.ErrNotSupported)
+}
+
+func lookup(id string) ([]byte, error) {
+	return nil, fmt.Errorf("keyring %s: %w", id, secrets.ErrNotSupported)
+}
+
+func status() error {
+	return fmt.Errorf("kernel keyring: %w", secrets.ErrNotSupported)
+}
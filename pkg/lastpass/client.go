@@ -9,10 +9,15 @@ import (
 	"strings"
 
 	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/secrets"
 )
 
 type Client struct {
-	Lookup func(id string) ([]byte, error)
+	// ListIDs returns the ids of all entries.
+	ListIDs func() ([]string, error)
+	Lookup  func(id string) ([]byte, error)
+	// Status returns an error if not logged in.
+	Status func() error
 }
 
 type Entry struct {
@@ -29,11 +34,63 @@ type Entry struct {
 	Username        string `json:"username"`
 }
 
+var (
+	_ secrets.CachingProvider = Client{}
+	_ secrets.FuncProvider    = Client{}
+)
+
 func (c Client) AddFuncs(funcs map[string]any) {
 	funcs["lastpassFormat"] = c.GetFormat
 	funcs["lastpassJSON"] = c.GetJSON
 }
 
+// Check implements [secrets.Provider].
+func (c Client) Check() error {
+	if c.Status == nil {
+		return nil
+	}
+	return c.Status()
+}
+
+// Get implements [secrets.Provider] returning the password of the entry.
+func (c Client) Get(id string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Password, nil
+}
+
+// GetField implements [secrets.Provider] returning the named attribute of the
+// entry (see Entry.Format for the supported names).
+func (c Client) GetField(id string, name string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	v, ok := entry.attribute(name)
+	if !ok {
+		return "", fmt.Errorf("unknown lastpass field: %s", name)
+	}
+	return v, nil
+}
+
+// List implements [secrets.Provider].
+func (c Client) List() ([]string, error) {
+	if c.ListIDs == nil {
+		return nil, fmt.Errorf("list lastpass: %w", secrets.ErrNotSupported)
+	}
+	return c.ListIDs()
+}
+
+// WithCache implements [secrets.CachingProvider].
+func (c Client) WithCache(cache *secrets.Cache) secrets.Provider {
+	c.Lookup = cache.Wrap("lastpass", c.Lookup)
+	return c
+}
+
 func (c Client) GetJSON(id string) (string, error) {
 	data, err := c.Lookup(id)
 	if err != nil {
@@ -67,33 +124,15 @@ func (c Client) unmarshal(id string) (*Entry, error) {
 	return &entry[0], nil
 }
 
+// Format returns format populated with the entry attributes in name. Supported
+// names are: fullname, group, id, last_modified_gmt, last_touch, name, note,
+// password, share, url, and username.
 func (e *Entry) Format(format string, name ...string) string {
 	formatArgs := make([]any, len(name))
 	for i, n := range name {
 		var v any
-		switch n {
-		case "fullname":
-			v = e.Fullname
-		case "group":
-			v = e.Group
-		case "id":
-			v = e.ID
-		case "last_modified_gmt":
-			v = e.LastModifiedGmt
-		case "last_touch":
-			v = e.LastTouch
-		case "name":
-			v = e.Name
-		case "note":
-			v = e.Note
-		case "password":
-			v = e.Password
-		case "share":
-			v = e.Share
-		case "url":
-			v = e.URL
-		case "username":
-			v = e.Username
+		if attr, ok := e.attribute(n); ok {
+			v = attr
 		}
 		formatArgs[i] = v
 	}
@@ -101,16 +140,68 @@ func (e *Entry) Format(format string, name ...string) string {
 	return fmt.Sprintf(format, formatArgs...)
 }
 
+func (e *Entry) attribute(name string) (string, bool) {
+	switch name {
+	case "fullname":
+		return e.Fullname, true
+	case "group":
+		return e.Group, true
+	case "id":
+		return e.ID, true
+	case "last_modified_gmt":
+		return e.LastModifiedGmt, true
+	case "last_touch":
+		return e.LastTouch, true
+	case "name":
+		return e.Name, true
+	case "note":
+		return e.Note, true
+	case "password":
+		return e.Password, true
+	case "share":
+		return e.Share, true
+	case "url":
+		return e.URL, true
+	case "username":
+		return e.Username, true
+	}
+	return "", false
+}
+
 func New() *Client {
 	return &Client{
-		Lookup: lookup,
+		ListIDs: listIDs,
+		Lookup:  lookup,
+		Status:  status,
+	}
+}
+
+func listIDs() ([]string, error) {
+	log.Logger.Trace().Str("provider", "lastpass").Msg("listIDs")
+	stdout, err := run("lpass", "ls", "--format", "%ai")
+	if err != nil {
+		return nil, err
 	}
+
+	return strings.Fields(string(stdout)), nil
 }
 
 func lookup(id string) ([]byte, error) {
 	log.Logger.Trace().Str("provider", "lastpass").Str("id", id).Msg("getJSON")
-	//nolint:gosec // id is safe in command getting invoked
-	cmd := exec.Command("lpass", "show", id, "--json")
+	return run("lpass", "show", id, "--json")
+}
+
+func status() error {
+	_, err := run("lpass", "status", "--quiet")
+	if err != nil {
+		return fmt.Errorf("lpass not logged in, run `lpass login` and try again: %w", err)
+	}
+	return nil
+}
+
+func run(args ...string) ([]byte, error) {
+	//nolint:gosec // args are safe in command getting invoked
+	cmd := exec.Command(args[0], args[1:]...)
 
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
@@ -41,3 +41,32 @@ func TestFormat(t *testing.T) {
 			"user/pass")
 	})
 }
+
+func TestProvider(t *testing.T) {
+	client := staticLookupClient(`[
+  {
+    "id": "3818021426",
+    "name": "foo",
+    "username": "user",
+    "password": "pass",
+    "url": "https://dip.dap.org"
+  }
+]`)
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := client.Get("")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("field", func(t *testing.T) {
+		actual, err := client.GetField("", "url")
+		require.NoError(t, err)
+		require.Equal(t, "https://dip.dap.org", actual)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		_, err := client.GetField("", "unknown")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,368 @@
+package onepassword
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// ErrInvalidReference is returned for secret references that are not of the
+// form op://vault/item/[section/]field.
+var ErrInvalidReference = errors.New("invalid 1password secret reference")
+
+type Client struct {
+	// ListIDs returns the ids of all items.
+	ListIDs func() ([]string, error)
+	// Lookup returns the json of the item with the supplied id. The id is
+	// either an item id (or name) or a reference to an item in a specific
+	// vault of the form op://vault/item.
+	Lookup func(id string) ([]byte, error)
+	// Status returns an error if not signed in.
+	Status func() error
+}
+
+type Entry struct {
+	Category string    `json:"category"`
+	Fields   []Field   `json:"fields"`
+	ID       string    `json:"id"`
+	Sections []Section `json:"sections"`
+	Title    string    `json:"title"`
+	URLs     []URL     `json:"urls"`
+	Vault    Vault     `json:"vault"`
+}
+
+type Field struct {
+	ID        string   `json:"id"`
+	Label     string   `json:"label"`
+	Purpose   string   `json:"purpose"`
+	Reference string   `json:"reference"`
+	Section   *Section `json:"section"`
+	Type      string   `json:"type"`
+	Value     string   `json:"value"`
+}
+
+// Reference is a parsed op://vault/item/[section/]field secret reference.
+type Reference struct {
+	Field   string
+	Item    string
+	Section string
+	Vault   string
+}
+
+type Section struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type URL struct {
+	Href    string `json:"href"`
+	Label   string `json:"label"`
+	Primary bool   `json:"primary"`
+}
+
+type Vault struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+var (
+	_ secrets.CachingProvider = Client{}
+	_ secrets.FuncProvider    = Client{}
+)
+
+func (c Client) AddFuncs(funcs map[string]any) {
+	funcs["onepassword"] = c.Get
+	funcs["onepasswordField"] = c.GetField
+	funcs["onepasswordFormat"] = c.GetFormat
+	funcs["onepasswordJSON"] = c.GetJSON
+	funcs["onepasswordRead"] = c.Read
+	funcs["onepasswordSectionField"] = c.GetSectionField
+}
+
+// Check implements [secrets.Provider].
+func (c Client) Check() error {
+	if c.Status == nil {
+		return nil
+	}
+	return c.Status()
+}
+
+// Get implements [secrets.Provider] returning the password of the item. If id
+// is a reference to a field (ie: op://vault/item/field), the value of that
+// field is returned instead.
+func (c Client) Get(id string) (string, error) {
+	if strings.HasPrefix(id, "op://") && strings.Count(id, "/") > 3 {
+		return c.Read(id)
+	}
+
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	v, _ := entry.attribute("password")
+	return v, nil
+}
+
+// GetField returns the value of the field whose label (or id) is name, from
+// any section. If no field exists with that name, the entry attribute of that
+// name is returned (see Entry.Format for the supported names). This also
+// implements [secrets.Provider].
+func (c Client) GetField(id string, name string) (string, error) {
+	return c.GetSectionField(id, "", name)
+}
+
+func (c Client) GetFormat(id string, format string, name ...string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Format(format, name...), nil
+}
+
+func (c Client) GetJSON(id string) (string, error) {
+	data, err := c.lookup(id)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// GetSectionField returns the value of the field whose label (or id) is name
+// in the section whose label (or id) is section. An empty section matches
+// fields in any section.
+func (c Client) GetSectionField(id string, section string, name string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	if field, ok := entry.Field(section, name); ok {
+		return field.Value, nil
+	}
+
+	if section == "" {
+		if v, ok := entry.attribute(name); ok {
+			return v, nil
+		}
+	}
+
+	return "", fmt.Errorf("1password field not found in %s: %s", id, name)
+}
+
+// List implements [secrets.Provider].
+func (c Client) List() ([]string, error) {
+	if c.ListIDs == nil {
+		return nil, fmt.Errorf("list onepassword: %w", secrets.ErrNotSupported)
+	}
+	return c.ListIDs()
+}
+
+// WithCache implements [secrets.CachingProvider].
+func (c Client) WithCache(cache *secrets.Cache) secrets.Provider {
+	c.Lookup = cache.Wrap("onepassword", c.Lookup)
+	return c
+}
+
+// Read returns the value of the field identified by a secret reference of the
+// form op://vault/item/[section/]field.
+func (c Client) Read(ref string) (string, error) {
+	reference, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	return c.GetSectionField(
+		fmt.Sprintf("op://%s/%s", reference.Vault, reference.Item),
+		reference.Section,
+		reference.Field)
+}
+
+// lookup calls Lookup normalizing references to items so that they share a
+// single lookup (and cache entry).
+func (c Client) lookup(id string) ([]byte, error) {
+	if strings.HasPrefix(id, "op://") {
+		vault, item, ok := strings.Cut(strings.TrimPrefix(id, "op://"), "/")
+		if !ok || vault == "" || item == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidReference, id)
+		}
+		item, _, _ = strings.Cut(item, "/")
+		id = fmt.Sprintf("op://%s/%s", vault, item)
+	}
+	return c.Lookup(id)
+}
+
+func (c Client) unmarshal(id string) (*Entry, error) {
+	data, err := c.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal op item: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// Field returns the field whose label (or id) is name in the section whose
+// label (or id) is section. An empty section matches fields in any section.
+// Names are matched case insensitively, as they are by op.
+func (e *Entry) Field(section string, name string) (*Field, bool) {
+	for i, field := range e.Fields {
+		if section != "" && (field.Section == nil ||
+			!strings.EqualFold(field.Section.Label, section) && !strings.EqualFold(field.Section.ID, section)) {
+			continue
+		}
+		if strings.EqualFold(field.Label, name) || strings.EqualFold(field.ID, name) {
+			return &e.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// Format returns format populated with the entry attributes in name. Supported
+// names are: category, id, notes, password, title, url, username, and vault.
+func (e *Entry) Format(format string, name ...string) string {
+	formatArgs := make([]any, len(name))
+	for i, n := range name {
+		var v any
+		if attr, ok := e.attribute(n); ok {
+			v = attr
+		}
+		formatArgs[i] = v
+	}
+
+	return fmt.Sprintf(format, formatArgs...)
+}
+
+func (e *Entry) attribute(name string) (string, bool) {
+	switch name {
+	case "category":
+		return e.Category, true
+	case "id":
+		return e.ID, true
+	case "notes":
+		return e.purpose("NOTES"), true
+	case "password":
+		return e.purpose("PASSWORD"), true
+	case "title":
+		return e.Title, true
+	case "url":
+		for _, url := range e.URLs {
+			if url.Primary {
+				return url.Href, true
+			}
+		}
+		if len(e.URLs) > 0 {
+			return e.URLs[0].Href, true
+		}
+		return "", true
+	case "username":
+		return e.purpose("USERNAME"), true
+	case "vault":
+		return e.Vault.Name, true
+	}
+	return "", false
+}
+
+// purpose returns the value of the field with the supplied purpose.
+func (e *Entry) purpose(purpose string) string {
+	for _, field := range e.Fields {
+		if field.Purpose == purpose {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// ParseReference parses a secret reference of the form
+// op://vault/item/[section/]field.
+func ParseReference(ref string) (Reference, error) {
+	parts := strings.Split(strings.TrimPrefix(ref, "op://"), "/")
+	if !strings.HasPrefix(ref, "op://") || len(parts) < 3 || len(parts) > 4 || slices.Contains(parts, "") {
+		return Reference{}, fmt.Errorf("%w: %s", ErrInvalidReference, ref)
+	}
+
+	reference := Reference{Vault: parts[0], Item: parts[1], Field: parts[len(parts)-1]}
+	if len(parts) == 4 {
+		reference.Section = parts[2]
+	}
+	return reference, nil
+}
+
+func New() *Client {
+	return &Client{
+		ListIDs: listIDs,
+		Lookup:  lookup,
+		Status:  status,
+	}
+}
+
+func listIDs() ([]string, error) {
+	log.Logger.Trace().Str("provider", "onepassword").Msg("listIDs")
+	stdout, err := run("op", "item", "list", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Entry
+	err = json.Unmarshal(stdout, &items)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal op item list: %w", err)
+	}
+
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids, nil
+}
+
+func lookup(id string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "onepassword").Str("id", id).Msg("getJSON")
+	args := []string{"op", "item", "get", id, "--format", "json"}
+	if strings.HasPrefix(id, "op://") {
+		vault, item, _ := strings.Cut(strings.TrimPrefix(id, "op://"), "/")
+		args = []string{"op", "item", "get", item, "--vault", vault, "--format", "json"}
+	}
+	return run(args...)
+}
+
+func status() error {
+	_, err := run("op", "whoami")
+	if err != nil {
+		return fmt.Errorf("op not signed in, run `eval $(op signin)` and try again: %w", err)
+	}
+	return nil
+}
+
+func run(args ...string) ([]byte, error) {
+	//nolint:gosec // args are safe in command getting invoked
+	cmd := exec.Command(args[0], args[1:]...)
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if err != nil {
+		errStr := stderr.String()
+		if strings.Contains(strings.ToLower(errStr), "not currently signed in") {
+			return nil, errors.New("op not signed in, run `eval $(op signin)` and try again")
+		}
+		return nil, fmt.Errorf("run op (%s): %w", stderr.String(), err)
+	}
+
+	return stdout.Bytes(), nil
+}
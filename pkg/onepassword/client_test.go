@@ -0,0 +1,187 @@
+package onepassword_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/onepassword"
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+const item = `{
+  "id": "kp2td65r4wbuhocwhhijpdbfqq",
+  "title": "example.org",
+  "version": 3,
+  "vault": {
+    "id": "vfbuiz4gkvz5ruqbhlmnoyxmpy",
+    "name": "Private"
+  },
+  "category": "LOGIN",
+  "sections": [
+    {
+      "id": "add more"
+    },
+    {
+      "id": "linl4sa2k5wplj6hpn7ibvf5hm",
+      "label": "Database"
+    }
+  ],
+  "fields": [
+    {
+      "id": "username",
+      "type": "STRING",
+      "purpose": "USERNAME",
+      "label": "username",
+      "value": "user",
+      "reference": "op://Private/example.org/username"
+    },
+    {
+      "id": "password",
+      "type": "CONCEALED",
+      "purpose": "PASSWORD",
+      "label": "password",
+      "value": "pass",
+      "reference": "op://Private/example.org/password"
+    },
+    {
+      "id": "notesPlain",
+      "type": "STRING",
+      "purpose": "NOTES",
+      "label": "notesPlain",
+      "value": "These are some notes",
+      "reference": "op://Private/example.org/notesPlain"
+    },
+    {
+      "id": "jt3kd6u6xtl6j2vhj5pfcnrq2a",
+      "section": {
+        "id": "add more"
+      },
+      "type": "STRING",
+      "label": "host",
+      "value": "www.example.org",
+      "reference": "op://Private/example.org/add more/host"
+    },
+    {
+      "id": "q3f6jgfqn4dfq6zrgu6glc5ewu",
+      "section": {
+        "id": "linl4sa2k5wplj6hpn7ibvf5hm",
+        "label": "Database"
+      },
+      "type": "STRING",
+      "label": "host",
+      "value": "db.example.org",
+      "reference": "op://Private/example.org/Database/host"
+    }
+  ],
+  "urls": [
+    {
+      "label": "website",
+      "href": "https://example.org/login"
+    },
+    {
+      "label": "website",
+      "primary": true,
+      "href": "https://example.org"
+    }
+  ]
+}`
+
+func staticLookupClient(lookedUp *[]string) onepassword.Client {
+	return onepassword.Client{
+		Lookup: func(id string) ([]byte, error) {
+			*lookedUp = append(*lookedUp, id)
+			switch id {
+			case "example.org", "op://Private/example.org":
+				return []byte(item), nil
+			}
+			return nil, errors.New("not found")
+		},
+	}
+}
+
+func TestField(t *testing.T) {
+	var lookedUp []string
+	client := staticLookupClient(&lookedUp)
+
+	test := func(t *testing.T, section string, name string, expected string) {
+		actual, err := client.GetSectionField("example.org", section, name)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+	}
+
+	t.Run("label", func(t *testing.T) { test(t, "", "username", "user") })
+	t.Run("case insensitive", func(t *testing.T) { test(t, "", "Password", "pass") })
+	t.Run("first in any section", func(t *testing.T) { test(t, "", "host", "www.example.org") })
+	t.Run("section label", func(t *testing.T) { test(t, "database", "host", "db.example.org") })
+	t.Run("section id", func(t *testing.T) { test(t, "linl4sa2k5wplj6hpn7ibvf5hm", "host", "db.example.org") })
+	t.Run("attribute", func(t *testing.T) { test(t, "", "url", "https://example.org") })
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := client.GetSectionField("example.org", "Database", "port")
+		require.EqualError(t, err, "1password field not found in example.org: port")
+	})
+}
+
+func TestFormat(t *testing.T) {
+	var lookedUp []string
+	actual, err := staticLookupClient(&lookedUp).GetFormat("example.org", "%s:%s@%s", "username", "password", "vault")
+	require.NoError(t, err)
+	require.Equal(t, "user:pass@Private", actual)
+}
+
+func TestRead(t *testing.T) {
+	test := func(t *testing.T, ref string, expected string) {
+		var lookedUp []string
+		actual, err := staticLookupClient(&lookedUp).Read(ref)
+		require.NoError(t, err)
+		require.Equal(t, expected, actual)
+		require.Equal(t, []string{"op://Private/example.org"}, lookedUp)
+	}
+
+	t.Run("field", func(t *testing.T) { test(t, "op://Private/example.org/password", "pass") })
+	t.Run("section", func(t *testing.T) { test(t, "op://Private/example.org/Database/host", "db.example.org") })
+
+	t.Run("invalid", func(t *testing.T) {
+		var lookedUp []string
+		for _, ref := range []string{"Private/example.org/password", "op://Private/example.org", "op://Private//password"} {
+			_, err := staticLookupClient(&lookedUp).Read(ref)
+			require.ErrorIs(t, err, onepassword.ErrInvalidReference)
+		}
+		require.Empty(t, lookedUp)
+	})
+}
+
+func TestProvider(t *testing.T) {
+	var lookedUp []string
+	client := staticLookupClient(&lookedUp)
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := client.Get("example.org")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("get item reference", func(t *testing.T) {
+		actual, err := client.Get("op://Private/example.org")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("get field reference", func(t *testing.T) {
+		actual, err := client.Get("op://Private/example.org/username")
+		require.NoError(t, err)
+		require.Equal(t, "user", actual)
+	})
+
+	t.Run("field falls back to attribute", func(t *testing.T) {
+		actual, err := client.GetField("example.org", "notes")
+		require.NoError(t, err)
+		require.Equal(t, "These are some notes", actual)
+	})
+
+	t.Run("list not supported", func(t *testing.T) {
+		_, err := client.List()
+		require.ErrorIs(t, err, secrets.ErrNotSupported)
+	})
+}
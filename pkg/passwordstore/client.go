@@ -0,0 +1,310 @@
+package passwordstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+type Client struct {
+	// ListIDs returns the ids of all entries.
+	ListIDs func() ([]string, error)
+	// Lookup returns the decrypted content of the entry with the supplied id.
+	Lookup func(id string) ([]byte, error)
+	// Status returns an error if the store is not available.
+	Status func() error
+}
+
+// Entry is a decrypted pass entry. By convention, the first line is the
+// password and the remaining lines may contain `key: value` metadata.
+type Entry struct {
+	// Fields are the `key: value` lines following the password, in order.
+	Fields []Field
+	// Notes are the remaining lines following the password that are not
+	// fields.
+	Notes    string
+	Password string
+}
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+var (
+	_ secrets.CachingProvider = Client{}
+	_ secrets.FuncProvider    = Client{}
+)
+
+func (c Client) AddFuncs(funcs map[string]any) {
+	funcs["passwordstore"] = c.Get
+	funcs["passwordstoreField"] = c.GetField
+	funcs["passwordstoreFormat"] = c.GetFormat
+	funcs["passwordstoreRaw"] = c.GetRaw
+}
+
+// Check implements [secrets.Provider].
+func (c Client) Check() error {
+	if c.Status == nil {
+		return nil
+	}
+	return c.Status()
+}
+
+// Get implements [secrets.Provider] returning the password (first line) of the
+// entry.
+func (c Client) Get(id string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Password, nil
+}
+
+// GetField returns the value of the `name: value` line of the entry. If no
+// such line exists, the entry attribute of that name is returned (see
+// Entry.Format for the supported names). This also implements
+// [secrets.Provider].
+func (c Client) GetField(id string, name string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	if v, ok := entry.Field(name); ok {
+		return v, nil
+	}
+
+	if v, ok := entry.attribute(name); ok {
+		return v, nil
+	}
+
+	return "", fmt.Errorf("pass field not found in %s: %s", id, name)
+}
+
+func (c Client) GetFormat(id string, format string, name ...string) (string, error) {
+	entry, err := c.unmarshal(id)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Format(format, name...), nil
+}
+
+// GetRaw returns the entire decrypted content of the entry.
+func (c Client) GetRaw(id string) (string, error) {
+	data, err := c.Lookup(id)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// List implements [secrets.Provider].
+func (c Client) List() ([]string, error) {
+	if c.ListIDs == nil {
+		return nil, fmt.Errorf("list passwordstore: %w", secrets.ErrNotSupported)
+	}
+	return c.ListIDs()
+}
+
+// WithCache implements [secrets.CachingProvider].
+func (c Client) WithCache(cache *secrets.Cache) secrets.Provider {
+	c.Lookup = cache.Wrap("passwordstore", c.Lookup)
+	return c
+}
+
+func (c Client) unmarshal(id string) (*Entry, error) {
+	data, err := c.Lookup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data), nil
+}
+
+// Field returns the value of the first `name: value` line. Names are matched
+// exactly if possible, case insensitively otherwise.
+func (e *Entry) Field(name string) (string, bool) {
+	for _, field := range e.Fields {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	for _, field := range e.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Format returns format populated with the entry fields or attributes in
+// name. Supported attributes are: notes and password.
+func (e *Entry) Format(format string, name ...string) string {
+	formatArgs := make([]any, len(name))
+	for i, n := range name {
+		var v any
+		if field, ok := e.Field(n); ok {
+			v = field
+		} else if attr, ok := e.attribute(n); ok {
+			v = attr
+		}
+		formatArgs[i] = v
+	}
+
+	return fmt.Sprintf(format, formatArgs...)
+}
+
+func (e *Entry) attribute(name string) (string, bool) {
+	switch name {
+	case "notes":
+		return e.Notes, true
+	case "password":
+		return e.Password, true
+	}
+	return "", false
+}
+
+// Parse parses the decrypted content of an entry.
+func Parse(data []byte) *Entry {
+	password, rest, _ := strings.Cut(string(data), "\n")
+	entry := Entry{Password: strings.TrimSuffix(password, "\r")}
+
+	var notes []string
+	for _, line := range strings.Split(strings.TrimRight(rest, "\r\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		name, value, ok := strings.Cut(line, ":")
+		// urls (ie: otpauth://...) are not fields
+		if ok && name != "" && !strings.ContainsAny(name, " \t") && !strings.HasPrefix(value, "//") {
+			entry.Fields = append(entry.Fields, Field{Name: name, Value: strings.TrimSpace(value)})
+			continue
+		}
+		notes = append(notes, line)
+	}
+	entry.Notes = strings.TrimSpace(strings.Join(notes, "\n"))
+
+	return &entry
+}
+
+// New returns a client that reads entries using `pass show` if pass is
+// installed, or by decrypting them directly from the store with gpg
+// otherwise.
+func New() *Client {
+	if _, err := exec.LookPath("pass"); err != nil {
+		return NewStore("")
+	}
+
+	dir := storeDir("")
+	return &Client{
+		ListIDs: func() ([]string, error) { return listIDs(dir) },
+		Lookup:  passLookup,
+		Status:  func() error { return status(dir) },
+	}
+}
+
+// NewStore returns a client that decrypts entries directly from the store in
+// dir using gpg. If dir is empty, $PASSWORD_STORE_DIR or ~/.password-store is
+// used. gpg will use $GNUPGHOME and the running gpg-agent as usual.
+func NewStore(dir string) *Client {
+	dir = storeDir(dir)
+	return &Client{
+		ListIDs: func() ([]string, error) { return listIDs(dir) },
+		Lookup:  func(id string) ([]byte, error) { return gpgLookup(dir, id) },
+		Status:  func() error { return status(dir) },
+	}
+}
+
+func storeDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("PASSWORD_STORE_DIR"); dir != "" {
+		return dir
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".password-store"
+	}
+	return filepath.Join(homeDir, ".password-store")
+}
+
+func listIDs(dir string) ([]string, error) {
+	log.Logger.Trace().Str("provider", "passwordstore").Msg("listIDs")
+	var ids []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && path != dir {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".gpg") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("relative path %s: %w", path, err)
+		}
+		ids = append(ids, filepath.ToSlash(strings.TrimSuffix(rel, ".gpg")))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list pass store: %w", err)
+	}
+	return ids, nil
+}
+
+func passLookup(id string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "passwordstore").Str("id", id).Msg("show")
+	return run("pass", "show", id)
+}
+
+func gpgLookup(dir string, id string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "passwordstore").Str("id", id).Msg("decrypt")
+	if !filepath.IsLocal(id) {
+		return nil, fmt.Errorf("invalid pass entry: %s", id)
+	}
+	return run("gpg", "--quiet", "--batch", "--decrypt", filepath.Join(dir, id+".gpg"))
+}
+
+func status(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("pass store not found, run `pass init` and try again: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("pass store not a directory: %s", dir)
+	}
+	return nil
+}
+
+func run(args ...string) ([]byte, error) {
+	//nolint:gosec // args are safe in command getting invoked
+	cmd := exec.Command(args[0], args[1:]...)
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	if err != nil {
+		errStr := stderr.String()
+		if strings.Contains(strings.ToLower(errStr), "no secret key") {
+			return nil, errors.New("gpg secret key not available, check GNUPGHOME and try again")
+		}
+		return nil, fmt.Errorf("run %s (%s): %w", args[0], stderr.String(), err)
+	}
+
+	return stdout.Bytes(), nil
+}
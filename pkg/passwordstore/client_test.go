@@ -0,0 +1,128 @@
+package passwordstore_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/passwordstore"
+	"github.com/stretchr/testify/require"
+)
+
+const entry = `pass
+username: user
+url: https://example.org/login
+otpauth://totp/example.org?secret=JBSWY3DPEHPK3PXP
+These are
+some notes
+`
+
+func staticLookupClient(data string) passwordstore.Client {
+	return passwordstore.Client{
+		Lookup: func(_ string) ([]byte, error) { return []byte(data), nil },
+	}
+}
+
+func TestParse(t *testing.T) {
+	require.Equal(t,
+		&passwordstore.Entry{
+			Fields: []passwordstore.Field{
+				{Name: "username", Value: "user"},
+				{Name: "url", Value: "https://example.org/login"},
+			},
+			Notes:    "otpauth://totp/example.org?secret=JBSWY3DPEHPK3PXP\nThese are\nsome notes",
+			Password: "pass",
+		},
+		passwordstore.Parse([]byte(entry)))
+
+	require.Equal(t, &passwordstore.Entry{Password: "only"}, passwordstore.Parse([]byte("only\n")))
+}
+
+func TestProvider(t *testing.T) {
+	client := staticLookupClient(entry)
+
+	t.Run("get", func(t *testing.T) {
+		actual, err := client.Get("")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("field", func(t *testing.T) {
+		actual, err := client.GetField("", "Username")
+		require.NoError(t, err)
+		require.Equal(t, "user", actual)
+	})
+
+	t.Run("field falls back to attribute", func(t *testing.T) {
+		actual, err := client.GetField("", "password")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		_, err := client.GetField("example.org", "pin")
+		require.EqualError(t, err, "pass field not found in example.org: pin")
+	})
+
+	t.Run("format", func(t *testing.T) {
+		actual, err := client.GetFormat("", "%s:%s@%s", "username", "password", "url")
+		require.NoError(t, err)
+		require.Equal(t, "user:pass@https://example.org/login", actual)
+	})
+}
+
+func TestStore(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+
+	// t.TempDir can exceed the max length of the gpg-agent socket path
+	gnupgHome, err := os.MkdirTemp("", "gnupg")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+		_ = os.RemoveAll(gnupgHome)
+	})
+	t.Setenv("GNUPGHOME", gnupgHome)
+
+	gpg := func(stdin string, args ...string) {
+		cmd := exec.Command("gpg", append([]string{"--batch", "--quiet"}, args...)...)
+		if stdin != "" {
+			cmd.Stdin = bytes.NewBufferString(stdin)
+		}
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	gpg("", "--passphrase", "", "--quick-gen-key", "pass@example.org", "default", "default", "never")
+
+	store := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(store, "web"), 0o700))
+	require.NoError(t, os.MkdirAll(filepath.Join(store, ".git"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(store, ".gpg-id"), []byte("pass@example.org\n"), 0o600))
+	gpg(entry, "--recipient", "pass@example.org", "--output", filepath.Join(store, "web", "example.org.gpg"), "--encrypt")
+
+	client := passwordstore.NewStore(store)
+	require.NoError(t, client.Check())
+
+	ids, err := client.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{"web/example.org"}, ids)
+
+	password, err := client.Get("web/example.org")
+	require.NoError(t, err)
+	require.Equal(t, "pass", password)
+
+	username, err := client.GetField("web/example.org", "username")
+	require.NoError(t, err)
+	require.Equal(t, "user", username)
+
+	_, err = client.Get("../outside")
+	require.Error(t, err)
+
+	_, err = client.Get("missing")
+	require.Error(t, err)
+
+	require.Error(t, passwordstore.NewStore(filepath.Join(store, "missing")).Check())
+}
@@ -0,0 +1,273 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/xdg"
+)
+
+// Cache memoizes secret lookups so that an entry referenced many times is only
+// fetched once. Entries are held in memory for the life of the Cache (config
+// loads use a new Cache for each load). If a TTL and a key are set (see WithTTL
+// and WithKey), entries are also persisted to disk, encrypted, so that they can
+// be reused by later loads (and processes) until they expire.
+type Cache struct {
+	dir     string
+	entries map[string]*cacheEntry
+	key     []byte
+	mu      sync.Mutex
+	now     func() time.Time
+	ttl     time.Duration
+}
+
+// CacheOption configures a Cache.
+type CacheOption func(*Cache)
+
+// WithDir persists entries in dir rather than configloader/secrets under
+// xdg.RuntimeDir().
+func WithDir(dir string) CacheOption {
+	return func(c *Cache) {
+		c.dir = dir
+	}
+}
+
+// WithKey encrypts persisted entries using AES-GCM with key, which must be 16,
+// 24 or 32 bytes (ie: a key read from the kernel keyring or a password
+// manager). Entries are never persisted without a key.
+func WithKey(key []byte) CacheOption {
+	return func(c *Cache) {
+		c.key = key
+	}
+}
+
+// WithTTL persists entries to disk for ttl. It has no effect without WithKey,
+// as secrets are never written to disk in plain text.
+func WithTTL(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// WithClock uses now, rather than time.Now, to expire persisted entries.
+func WithClock(now func() time.Time) CacheOption {
+	return func(c *Cache) {
+		c.now = now
+	}
+}
+
+type cacheEntry struct {
+	data []byte
+	done chan struct{}
+	err  error
+}
+
+type persistedEntry struct {
+	Data    []byte    `json:"data"`
+	Expires time.Time `json:"expires"`
+}
+
+// Wrap returns a lookup function that memoizes the results of lookup. The
+// provider name is used to keep the ids of different providers distinct.
+func (c *Cache) Wrap(
+	provider string,
+	lookup func(id string) ([]byte, error),
+) func(id string) ([]byte, error) {
+	return func(id string) ([]byte, error) {
+		return c.lookup(provider, id, lookup)
+	}
+}
+
+// WrapField is Wrap for lookups of a single field (or attribute) of an entry.
+func (c *Cache) WrapField(
+	provider string,
+	lookup func(id string, field string) ([]byte, error),
+) func(id string, field string) ([]byte, error) {
+	return func(id string, field string) ([]byte, error) {
+		return c.lookup(provider, id+"\x00"+field, func(string) ([]byte, error) {
+			return lookup(id, field)
+		})
+	}
+}
+
+func (c *Cache) lookup(provider string, id string, lookup func(id string) ([]byte, error)) ([]byte, error) {
+	key := cacheKey(provider, id)
+	logger := log.Logger.With().Str("provider", provider).Str("id", id).Logger()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		c.mu.Unlock()
+		<-entry.done
+		if entry.err == nil {
+			logger.Debug().Msg("secret cache hit")
+		}
+		return entry.data, entry.err
+	}
+	entry = &cacheEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.mu.Unlock()
+	defer close(entry.done)
+
+	if c.persist() {
+		data, err := c.load(key)
+		if err != nil {
+			logger.Debug().Err(err).Msg("secret cache disk read failed")
+		} else if data != nil {
+			logger.Debug().Msg("secret cache disk hit")
+			entry.data = data
+			return data, nil
+		}
+	}
+
+	logger.Debug().Msg("secret cache miss")
+	entry.data, entry.err = lookup(id)
+	if entry.err != nil {
+		// do not memoize failures so that a later lookup may succeed (ie:
+		// after the vault is unlocked)
+		c.mu.Lock()
+		delete(c.entries, key)
+		c.mu.Unlock()
+		return nil, entry.err
+	}
+
+	if c.persist() {
+		err := c.store(key, entry.data)
+		if err != nil {
+			logger.Debug().Err(err).Msg("secret cache disk write failed")
+		}
+	}
+	return entry.data, nil
+}
+
+func (c *Cache) storeDir() (string, error) {
+	if c.dir != "" {
+		return c.dir, nil
+	}
+	runtimeDir, err := xdg.RuntimeDir()
+	if err != nil {
+		return "", fmt.Errorf("cache dir: %w", err)
+	}
+	return filepath.Join(runtimeDir, "configloader", "secrets"), nil
+}
+
+// persist returns true if entries are persisted to disk.
+func (c *Cache) persist() bool {
+	return c.ttl > 0 && c.key != nil
+}
+
+// gcm returns the cipher used to encrypt persisted entries.
+func (c *Cache) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, fmt.Errorf("cache cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cache gcm: %w", err)
+	}
+	return gcm, nil
+}
+
+// load returns the persisted entry for key, or nil if there is no unexpired
+// entry.
+func (c *Cache) load(key string) ([]byte, error) {
+	gcm, err := c.gcm()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := c.storeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(dir, key)
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read cache entry: %w", err)
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New("corrupt cache entry")
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt cache entry: %w", err)
+	}
+
+	var entry persistedEntry
+	err = json.Unmarshal(plain, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal cache entry: %w", err)
+	}
+
+	if !c.now().Before(entry.Expires) {
+		_ = os.Remove(file)
+		return nil, nil
+	}
+	return entry.Data, nil
+}
+
+func (c *Cache) store(key string, data []byte) error {
+	gcm, err := c.gcm()
+	if err != nil {
+		return err
+	}
+	dir, err := c.storeDir()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("create cache dir: %w", err)
+	}
+
+	b, err := json.Marshal(persistedEntry{Data: data, Expires: c.now().Add(c.ttl)})
+	if err != nil {
+		return fmt.Errorf("marshal cache entry: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return fmt.Errorf("generate cache nonce: %w", err)
+	}
+	b = gcm.Seal(nonce, nonce, b, []byte(key))
+
+	err = os.WriteFile(filepath.Join(dir, key), b, 0o600)
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+	return nil
+}
+
+func cacheKey(provider string, id string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + id))
+	return hex.EncodeToString(sum[:])
+}
+
+func NewCache(opts ...CacheOption) *Cache {
+	c := &Cache{entries: map[string]*cacheEntry{}, now: time.Now}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.ttl > 0 && c.key == nil {
+		log.Logger.Warn().Msg("secret cache not persisted as no key was supplied")
+	}
+	return c
+}
@@ -0,0 +1,148 @@
+package secrets_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	counting := func() (*atomic.Int32, func(id string) ([]byte, error)) {
+		var calls atomic.Int32
+		return &calls, func(id string) ([]byte, error) {
+			calls.Add(1)
+			if id == "missing" {
+				return nil, errors.New("not found")
+			}
+			return []byte("secret-" + id), nil
+		}
+	}
+
+	t.Run("memoized", func(t *testing.T) {
+		calls, lookup := counting()
+		cache := secrets.NewCache()
+		cached := cache.Wrap("test", lookup)
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := cached("a")
+				require.NoError(t, err)
+				require.Equal(t, "secret-a", string(data))
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, int32(1), calls.Load())
+
+		// providers do not share entries
+		_, err := cache.Wrap("other", lookup)("a")
+		require.NoError(t, err)
+		require.Equal(t, int32(2), calls.Load())
+
+		// a new cache (ie: the next load) looks up again
+		_, err = secrets.NewCache().Wrap("test", lookup)("a")
+		require.NoError(t, err)
+		require.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("errors not memoized", func(t *testing.T) {
+		calls, lookup := counting()
+		cached := secrets.NewCache().Wrap("test", lookup)
+		_, err := cached("missing")
+		require.Error(t, err)
+		_, err = cached("missing")
+		require.Error(t, err)
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		dir := t.TempDir()
+		calls, lookup := counting()
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := func() time.Time { return now }
+		newCache := func(opts ...secrets.CacheOption) *secrets.Cache {
+			return secrets.NewCache(append(
+				[]secrets.CacheOption{
+					secrets.WithDir(dir),
+					secrets.WithTTL(time.Hour),
+					secrets.WithKey([]byte("0123456789abcdef")),
+					secrets.WithClock(clock),
+				},
+				opts...)...)
+		}
+
+		data, err := newCache().Wrap("test", lookup)("a")
+		require.NoError(t, err)
+		require.Equal(t, "secret-a", string(data))
+
+		// a new cache (ie: another process) uses the persisted entry
+		data, err = newCache().Wrap("test", lookup)("a")
+		require.NoError(t, err)
+		require.Equal(t, "secret-a", string(data))
+		require.Equal(t, int32(1), calls.Load())
+
+		// expired entries are looked up again
+		now = now.Add(time.Hour)
+		_, err = newCache().Wrap("test", lookup)("a")
+		require.NoError(t, err)
+		require.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("ttl without key", func(t *testing.T) {
+		dir := t.TempDir()
+		calls, lookup := counting()
+		for range 2 {
+			_, err := secrets.NewCache(secrets.WithDir(dir), secrets.WithTTL(time.Hour)).Wrap("test", lookup)("a")
+			require.NoError(t, err)
+		}
+		require.Equal(t, int32(2), calls.Load())
+
+		// entries are never persisted in plain text
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("key", func(t *testing.T) {
+		dir := t.TempDir()
+		calls, lookup := counting()
+		key := []byte("0123456789abcdef0123456789abcdef")
+
+		_, err := secrets.NewCache(secrets.WithDir(dir), secrets.WithTTL(time.Hour), secrets.WithKey(key)).
+			Wrap("test", lookup)("a")
+		require.NoError(t, err)
+
+		// persisted entries are encrypted
+		entries, err := filepath.Glob(filepath.Join(dir, "*"))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		b, err := os.ReadFile(entries[0])
+		require.NoError(t, err)
+		require.NotContains(t, string(b), base64.StdEncoding.EncodeToString([]byte("secret-a")))
+
+		data, err := secrets.NewCache(secrets.WithDir(dir), secrets.WithTTL(time.Hour), secrets.WithKey(key)).
+			Wrap("test", lookup)("a")
+		require.NoError(t, err)
+		require.Equal(t, "secret-a", string(data))
+		require.Equal(t, int32(1), calls.Load())
+
+		// entries cannot be read with another key
+		_, err = secrets.NewCache(
+			secrets.WithDir(dir),
+			secrets.WithTTL(time.Hour),
+			secrets.WithKey([]byte("fedcba9876543210fedcba9876543210"))).
+			Wrap("test", lookup)("a")
+		require.NoError(t, err)
+		require.Equal(t, int32(2), calls.Load())
+	})
+}
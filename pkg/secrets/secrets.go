@@ -0,0 +1,153 @@
+// Package secrets defines a common interface for the password managers that
+// supply secrets to templates, and a registry to look them up by name.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ErrUnknownProvider is returned when a provider is not registered.
+var ErrUnknownProvider = errors.New("unknown secret provider")
+
+// ErrNotSupported is returned by providers that do not support an operation.
+var ErrNotSupported = errors.New("not supported")
+
+// Provider is implemented by password managers that can supply secrets.
+type Provider interface {
+	// Get returns the primary secret (ie: the password) of the entry
+	// identified by id.
+	Get(id string) (string, error)
+	// GetField returns the named field of the entry identified by id.
+	GetField(id string, field string) (string, error)
+	// List returns the ids of the entries available from the provider.
+	List() ([]string, error)
+	// Check returns an error if the provider is not ready for use (ie: the
+	// client is not installed or the session is locked).
+	Check() error
+}
+
+// FuncProvider is implemented by providers that supply their own provider
+// specific template functions in addition to the generic secret function.
+type FuncProvider interface {
+	Provider
+	AddFuncs(funcs map[string]any)
+}
+
+// CachingProvider is implemented by providers whose lookups can be memoized.
+type CachingProvider interface {
+	Provider
+	// WithCache returns a copy of the provider whose lookups are memoized by
+	// cache.
+	WithCache(cache *Cache) Provider
+}
+
+// Registry is a named collection of providers.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// Register adds provider to the registry under name, replacing any provider
+// previously registered with that name.
+func (r *Registry) Register(name string, provider Provider) {
+	r.providers[name] = provider
+}
+
+// Provider returns the provider registered under name.
+func (r *Registry) Provider(name string) (Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// Names returns the sorted names of all registered providers.
+func (r *Registry) Names() []string {
+	return slices.Sorted(maps.Keys(r.providers))
+}
+
+// Secret returns the primary secret of the entry identified by id from the
+// named provider, or the named field if one is supplied. It is available to
+// templates as:
+//
+//	password: '{{ secret "bitwarden" "example.com" }}'
+//	username: '{{ secret "bitwarden" "example.com" "username" }}'
+func (r *Registry) Secret(provider string, id string, field ...string) (string, error) {
+	p, err := r.Provider(provider)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(field) {
+	case 0:
+		v, err := p.Get(id)
+		if err != nil {
+			return "", fmt.Errorf("%s get %s: %w", provider, id, err)
+		}
+		return v, nil
+	case 1:
+		v, err := p.GetField(id, field[0])
+		if err != nil {
+			return "", fmt.Errorf("%s get %s field %s: %w", provider, id, field[0], err)
+		}
+		return v, nil
+	default:
+		return "", fmt.Errorf("secret accepts at most one field, got %d", len(field))
+	}
+}
+
+// AddFuncs adds the generic secret function along with the provider specific
+// functions of each FuncProvider.
+func (r *Registry) AddFuncs(funcs map[string]any) {
+	for _, name := range r.Names() {
+		if p, ok := r.providers[name].(FuncProvider); ok {
+			p.AddFuncs(funcs)
+		}
+	}
+	funcs["secret"] = r.Secret
+}
+
+// FuncNames returns the sorted names of the functions added by AddFuncs. All of
+// them look up secrets.
+func (r *Registry) FuncNames() []string {
+	funcs := map[string]any{}
+	r.AddFuncs(funcs)
+	return slices.Sorted(maps.Keys(funcs))
+}
+
+// FuncProviders returns the name of the provider of each of the provider
+// specific functions added by AddFuncs, keyed by function name. The generic
+// secret function is not included as its provider is its first argument.
+func (r *Registry) FuncProviders() map[string]string {
+	providers := map[string]string{}
+	for _, name := range r.Names() {
+		if p, ok := r.providers[name].(FuncProvider); ok {
+			funcs := map[string]any{}
+			p.AddFuncs(funcs)
+			for fn := range funcs {
+				providers[fn] = name
+			}
+		}
+	}
+	return providers
+}
+
+// WithCache returns a copy of the registry in which each CachingProvider is
+// replaced by a copy whose lookups are memoized by cache.
+func (r *Registry) WithCache(cache *Cache) *Registry {
+	cached := NewRegistry()
+	for name, provider := range r.providers {
+		if p, ok := provider.(CachingProvider); ok {
+			provider = p.WithCache(cache)
+		}
+		cached.Register(name, provider)
+	}
+	return cached
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: map[string]Provider{}}
+}
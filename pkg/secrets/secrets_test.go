@@ -0,0 +1,80 @@
+package secrets_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/secrets"
+	"github.com/stretchr/testify/require"
+)
+
+type staticProvider map[string]map[string]string
+
+func (p staticProvider) Get(id string) (string, error) {
+	return p.GetField(id, "password")
+}
+
+func (p staticProvider) GetField(id string, field string) (string, error) {
+	entry, ok := p[id]
+	if !ok {
+		return "", fmt.Errorf("not found: %s", id)
+	}
+	return entry[field], nil
+}
+
+func (p staticProvider) List() ([]string, error) {
+	ids := make([]string, 0, len(p))
+	for id := range p {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (staticProvider) Check() error {
+	return nil
+}
+
+func (p staticProvider) AddFuncs(funcs map[string]any) {
+	funcs["staticPassword"] = p.Get
+}
+
+func TestRegistry(t *testing.T) {
+	registry := secrets.NewRegistry()
+	registry.Register("static", staticProvider{
+		"example.com": {"password": "pass", "username": "user"},
+	})
+
+	t.Run("names", func(t *testing.T) {
+		require.Equal(t, []string{"static"}, registry.Names())
+	})
+
+	t.Run("secret", func(t *testing.T) {
+		actual, err := registry.Secret("static", "example.com")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+	})
+
+	t.Run("secret field", func(t *testing.T) {
+		actual, err := registry.Secret("static", "example.com", "username")
+		require.NoError(t, err)
+		require.Equal(t, "user", actual)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := registry.Secret("unknown", "example.com")
+		require.True(t, errors.Is(err, secrets.ErrUnknownProvider))
+	})
+
+	t.Run("funcs", func(t *testing.T) {
+		funcs := map[string]any{}
+		registry.AddFuncs(funcs)
+		require.Contains(t, funcs, "secret")
+		require.Contains(t, funcs, "staticPassword")
+	})
+
+	t.Run("func providers", func(t *testing.T) {
+		require.Equal(t, []string{"secret", "staticPassword"}, registry.FuncNames())
+		require.Equal(t, map[string]string{"staticPassword": "static"}, registry.FuncProviders())
+	})
+}
@@ -0,0 +1,414 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pastdev/configloader/pkg/log"
+	"github.com/pastdev/configloader/pkg/secrets"
+)
+
+// ErrNotFound is returned when there is no secret at the requested path.
+var ErrNotFound = errors.New("vault secret not found")
+
+// DefaultTimeout is the timeout of requests made by an API without an
+// HTTPClient.
+const DefaultTimeout = 30 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultTimeout}
+
+type Client struct {
+	// Lookup returns the json encoded data of the secret at path.
+	Lookup func(path string) ([]byte, error)
+	// Status returns an error if vault is not reachable or the token is not
+	// valid.
+	Status func() error
+}
+
+// API reads secrets from the kv secrets engine using the vault http api.
+type API struct {
+	// Address of the vault server (ie: https://vault.example.com:8200).
+	Address string
+	// AppRoleMount is the mount of the approle auth method used when RoleID
+	// is set. Defaults to approle.
+	AppRoleMount string
+	// HTTPClient used to make requests. Defaults to a client with
+	// DefaultTimeout.
+	HTTPClient *http.Client
+	// KVVersion forces the version (1 or 2) of the kv secrets engine rather
+	// than detecting it from the mount.
+	KVVersion int
+	Namespace string
+	// RoleID and SecretID are used to login using approle when Token is not
+	// set.
+	RoleID   string
+	SecretID string
+	Token    string
+
+	mounts map[string]mount
+	mu     sync.Mutex
+}
+
+type mount struct {
+	// known is false when the mount could not be detected and the version
+	// was not forced, in which case the path and version are a guess
+	known   bool
+	path    string
+	version int
+}
+
+var (
+	_ secrets.CachingProvider = Client{}
+	_ secrets.FuncProvider    = Client{}
+)
+
+func (c Client) AddFuncs(funcs map[string]any) {
+	funcs["vault"] = c.Get
+	funcs["vaultField"] = c.GetField
+	funcs["vaultFormat"] = c.GetFormat
+	funcs["vaultJSON"] = c.GetJSON
+}
+
+// Check implements [secrets.Provider].
+func (c Client) Check() error {
+	if c.Status == nil {
+		return nil
+	}
+	return c.Status()
+}
+
+// Data returns the data of the secret at path.
+func (c Client) Data(path string) (map[string]any, error) {
+	b, err := c.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]any
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal vault secret: %w", err)
+	}
+	return data, nil
+}
+
+// Get implements [secrets.Provider] returning the only field of the secret, or
+// its password field if it has more than one.
+func (c Client) Get(path string) (string, error) {
+	data, err := c.Data(path)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) == 1 {
+		for _, v := range data {
+			return format(v)
+		}
+	}
+	if v, ok := data["password"]; ok {
+		return format(v)
+	}
+	return "", fmt.Errorf("vault secret %s has multiple fields, select one using vaultField", path)
+}
+
+// GetField implements [secrets.Provider] returning the named field of the
+// secret. Values that are not strings are json encoded.
+func (c Client) GetField(path string, name string) (string, error) {
+	data, err := c.Data(path)
+	if err != nil {
+		return "", err
+	}
+
+	v, ok := data[name]
+	if !ok {
+		return "", fmt.Errorf("vault field not found in %s: %s", path, name)
+	}
+	return format(v)
+}
+
+// GetFormat returns format populated with the fields in name of the secret.
+func (c Client) GetFormat(path string, format string, name ...string) (string, error) {
+	formatArgs := make([]any, len(name))
+	for i, n := range name {
+		v, err := c.GetField(path, n)
+		if err != nil {
+			return "", err
+		}
+		formatArgs[i] = v
+	}
+
+	return fmt.Sprintf(format, formatArgs...), nil
+}
+
+func (c Client) GetJSON(path string) (string, error) {
+	b, err := c.Lookup(path)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// List implements [secrets.Provider]. Listing is not supported as vault only
+// lists the secrets below a path.
+func (Client) List() ([]string, error) {
+	return nil, fmt.Errorf("list vault: %w", secrets.ErrNotSupported)
+}
+
+// WithCache implements [secrets.CachingProvider].
+func (c Client) WithCache(cache *secrets.Cache) secrets.Provider {
+	c.Lookup = cache.Wrap("vault", c.Lookup)
+	return c
+}
+
+func format(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("marshal vault field: %w", err)
+	}
+	return string(b), nil
+}
+
+// Read returns the json encoded data of the kv secret at path (ie:
+// secret/myapp). The version of the kv secrets engine is detected from the
+// mount unless KVVersion is set.
+func (a *API) Read(path string) ([]byte, error) {
+	log.Logger.Trace().Str("provider", "vault").Str("id", path).Msg("read")
+	path = strings.Trim(path, "/")
+	m, err := a.mount(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if m.version == 2 {
+		err = a.request(http.MethodGet, m.path+"data/"+strings.TrimPrefix(path, m.path), nil, &resp)
+	} else {
+		err = a.request(http.MethodGet, path, nil, &resp)
+	}
+	if errors.Is(err, ErrNotFound) && !m.known {
+		// reading a kv v2 mount as v1 also finds nothing, so do not report
+		// the secret as missing
+		//nolint:errorlint // not found is ambiguous so is not wrapped
+		return nil, fmt.Errorf(
+			"vault %s: kv version of mount %s is unknown (set VAULT_KV_VERSION): %v",
+			path,
+			m.path,
+			err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.version == 2 {
+		var v2 struct {
+			Data json.RawMessage `json:"data"`
+		}
+		err = json.Unmarshal(resp.Data, &v2)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal vault kv v2 secret: %w", err)
+		}
+		return v2.Data, nil
+	}
+	return resp.Data, nil
+}
+
+// Status returns an error if vault is not reachable or the token is not valid.
+func (a *API) Status() error {
+	err := a.request(http.MethodGet, "auth/token/lookup-self", nil, nil)
+	if err != nil {
+		return fmt.Errorf("vault token not valid, run `vault login` and try again: %w", err)
+	}
+	return nil
+}
+
+// mount returns the kv mount containing path.
+func (a *API) mount(path string) (mount, error) {
+	a.mu.Lock()
+	var found *mount
+	for p, m := range a.mounts {
+		if strings.HasPrefix(path, p) && (found == nil || len(p) > len(found.path)) {
+			found = &m
+		}
+	}
+	a.mu.Unlock()
+	if found != nil {
+		return *found, nil
+	}
+
+	var resp struct {
+		Data struct {
+			Options map[string]string `json:"options"`
+			Path    string            `json:"path"`
+		} `json:"data"`
+	}
+	err := a.request(http.MethodGet, "sys/internal/ui/mounts/"+path, nil, &resp)
+
+	m := mount{known: true, path: resp.Data.Path, version: 1}
+	if err != nil || m.path == "" {
+		// tokens are not always permitted to read mount details, so assume
+		// the first segment of the path is the mount
+		log.Logger.Debug().Err(err).Str("path", path).Msg("vault mount detection failed")
+		first, _, _ := strings.Cut(path, "/")
+		m.known = false
+		m.path = first + "/"
+	} else if v, err := strconv.Atoi(resp.Data.Options["version"]); err == nil {
+		m.version = v
+	}
+	if a.KVVersion != 0 {
+		m.known = true
+		m.version = a.KVVersion
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.mounts == nil {
+		a.mounts = map[string]mount{}
+	}
+	a.mounts[m.path] = m
+	return m, nil
+}
+
+// token returns Token, logging in using approle first if necessary.
+func (a *API) token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.Token != "" || a.RoleID == "" {
+		return a.Token, nil
+	}
+
+	mount := a.AppRoleMount
+	if mount == "" {
+		mount = "approle"
+	}
+	body, err := json.Marshal(map[string]string{"role_id": a.RoleID, "secret_id": a.SecretID})
+	if err != nil {
+		return "", fmt.Errorf("marshal approle login: %w", err)
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	err = a.do(http.MethodPost, fmt.Sprintf("auth/%s/login", strings.Trim(mount, "/")), "", body, &resp)
+	if err != nil {
+		return "", fmt.Errorf("vault approle login: %w", err)
+	}
+	a.Token = resp.Auth.ClientToken
+	return a.Token, nil
+}
+
+func (a *API) request(method string, path string, body []byte, result any) error {
+	token, err := a.token()
+	if err != nil {
+		return err
+	}
+	return a.do(method, path, token, body, result)
+}
+
+func (a *API) do(method string, path string, token string, body []byte, result any) error {
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(a.Address, "/"), path)
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("vault request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if a.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", a.Namespace)
+	}
+
+	client := a.HTTPClient
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("vault read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(b, &errResp)
+		return fmt.Errorf("vault %s %s (%s): %s", method, path, resp.Status, strings.Join(errResp.Errors, ", "))
+	}
+
+	if result == nil {
+		return nil
+	}
+	err = json.Unmarshal(b, result)
+	if err != nil {
+		return fmt.Errorf("vault unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// NewAPI returns an API configured from the same environment variables as the
+// vault cli: VAULT_ADDR, VAULT_NAMESPACE, and VAULT_TOKEN (or ~/.vault-token).
+// If there is no token, VAULT_ROLE_ID and VAULT_SECRET_ID (and optionally
+// VAULT_APPROLE_MOUNT) are used to login using approle.
+func NewAPI() *API {
+	api := API{
+		Address:      os.Getenv("VAULT_ADDR"),
+		AppRoleMount: os.Getenv("VAULT_APPROLE_MOUNT"),
+		Namespace:    os.Getenv("VAULT_NAMESPACE"),
+		RoleID:       os.Getenv("VAULT_ROLE_ID"),
+		SecretID:     os.Getenv("VAULT_SECRET_ID"),
+		Token:        os.Getenv("VAULT_TOKEN"),
+	}
+	if api.Address == "" {
+		api.Address = "https://127.0.0.1:8200"
+	}
+	if api.Token == "" && api.RoleID == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			if b, err := os.ReadFile(filepath.Join(homeDir, ".vault-token")); err == nil {
+				api.Token = strings.TrimSpace(string(b))
+			}
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("VAULT_KV_VERSION")); err == nil && slices.Contains([]int{1, 2}, v) {
+		api.KVVersion = v
+	}
+	return &api
+}
+
+// New returns a client using the API configured by NewAPI.
+func New() *Client {
+	return NewClient(NewAPI())
+}
+
+// NewClient returns a client using api.
+func NewClient(api *API) *Client {
+	return &Client{
+		Lookup: api.Read,
+		Status: api.Status,
+	}
+}
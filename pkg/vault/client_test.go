@@ -0,0 +1,196 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pastdev/configloader/pkg/vault"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault is a stand in for a vault server with a kv v2 mount at secret/, a
+// kv v1 mount at secret/team/ and a kv v1 mount at kv/. The mount of other/
+// cannot be detected.
+type fakeVault struct {
+	namespace string
+	requests  []string
+	token     string
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	reply := func(status int, body any) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+
+	if r.Header.Get("X-Vault-Namespace") != f.namespace {
+		reply(http.StatusForbidden, map[string]any{"errors": []string{"wrong namespace"}})
+		return
+	}
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var login map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&login)
+		if login["role_id"] != "role" || login["secret_id"] != "secret" {
+			reply(http.StatusBadRequest, map[string]any{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		reply(http.StatusOK, map[string]any{"auth": map[string]any{"client_token": f.token}})
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != f.token {
+		reply(http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch path := r.URL.Path; {
+	case path == "/v1/auth/token/lookup-self":
+		reply(http.StatusOK, map[string]any{"data": map[string]any{}})
+	case strings.HasPrefix(path, "/v1/sys/internal/ui/mounts/secret/team/"):
+		reply(http.StatusOK, map[string]any{
+			"data": map[string]any{"path": "secret/team/", "type": "kv", "options": map[string]any{"version": "1"}},
+		})
+	case strings.HasPrefix(path, "/v1/sys/internal/ui/mounts/secret/"):
+		reply(http.StatusOK, map[string]any{
+			"data": map[string]any{"path": "secret/", "type": "kv", "options": map[string]any{"version": "2"}},
+		})
+	case strings.HasPrefix(path, "/v1/sys/internal/ui/mounts/kv/"):
+		reply(http.StatusOK, map[string]any{
+			"data": map[string]any{"path": "kv/", "type": "kv", "options": nil},
+		})
+	case path == "/v1/secret/data/myapp/db":
+		reply(http.StatusOK, map[string]any{
+			"data": map[string]any{
+				"data": map[string]any{
+					"password": "pass",
+					"port":     5432,
+					"username": "user",
+				},
+				"metadata": map[string]any{"version": 3},
+			},
+		})
+	case path == "/v1/secret/team/app":
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"password": "team"}})
+	case path == "/v1/kv/myapp/token":
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"token": "tok"}})
+	default:
+		reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+	}
+}
+
+func newServer(t *testing.T, f *fakeVault) *httptest.Server {
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient(t *testing.T) {
+	f := &fakeVault{namespace: "team", token: "s.token"}
+	server := newServer(t, f)
+	client := vault.NewClient(&vault.API{Address: server.URL, Namespace: "team", Token: "s.token"})
+
+	t.Run("kv v2", func(t *testing.T) {
+		actual, err := client.Get("secret/myapp/db")
+		require.NoError(t, err)
+		require.Equal(t, "pass", actual)
+
+		actual, err = client.GetField("secret/myapp/db", "port")
+		require.NoError(t, err)
+		require.Equal(t, "5432", actual)
+
+		actual, err = client.GetFormat("secret/myapp/db", "%s:%s", "username", "password")
+		require.NoError(t, err)
+		require.Equal(t, "user:pass", actual)
+	})
+
+	t.Run("kv v1", func(t *testing.T) {
+		actual, err := client.Get("kv/myapp/token")
+		require.NoError(t, err)
+		require.Equal(t, "tok", actual)
+	})
+
+	t.Run("mount detected once", func(t *testing.T) {
+		f.requests = nil
+		_, err := client.GetJSON("/secret/myapp/db/")
+		require.NoError(t, err)
+		require.Equal(t, []string{"GET /v1/secret/data/myapp/db"}, f.requests)
+	})
+
+	t.Run("longest mount", func(t *testing.T) {
+		client := vault.NewClient(&vault.API{Address: server.URL, Namespace: "team", Token: "s.token"})
+		actual, err := client.Get("secret/team/app")
+		require.NoError(t, err)
+		require.Equal(t, "team", actual)
+		_, err = client.Get("secret/myapp/db")
+		require.NoError(t, err)
+
+		// both secret/ and secret/team/ are now known
+		for range 10 {
+			actual, err = client.Get("secret/team/app")
+			require.NoError(t, err)
+			require.Equal(t, "team", actual)
+		}
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		_, err := client.GetField("secret/myapp/db", "pin")
+		require.EqualError(t, err, "vault field not found in secret/myapp/db: pin")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := client.Get("secret/missing")
+		require.ErrorIs(t, err, vault.ErrNotFound)
+	})
+
+	t.Run("not found in unknown mount", func(t *testing.T) {
+		// the secret may exist if other/ is kv v2, so it is not reported as
+		// missing
+		_, err := client.Get("other/missing")
+		require.ErrorContains(t, err, "kv version of mount other/ is unknown")
+		require.NotErrorIs(t, err, vault.ErrNotFound)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		require.NoError(t, client.Check())
+		bad := vault.NewClient(&vault.API{Address: server.URL, Namespace: "team", Token: "bad"})
+		require.ErrorContains(t, bad.Check(), "permission denied")
+		wrongNamespace := vault.NewClient(&vault.API{Address: server.URL, Token: "s.token"})
+		require.ErrorContains(t, wrongNamespace.Check(), "wrong namespace")
+	})
+}
+
+func TestAPI(t *testing.T) {
+	t.Run("approle from env", func(t *testing.T) {
+		f := &fakeVault{token: "s.approle"}
+		server := newServer(t, f)
+		t.Setenv("VAULT_ADDR", server.URL)
+		t.Setenv("VAULT_TOKEN", "")
+		t.Setenv("VAULT_NAMESPACE", "")
+		t.Setenv("VAULT_ROLE_ID", "role")
+		t.Setenv("VAULT_SECRET_ID", "secret")
+
+		client := vault.New()
+		actual, err := client.Get("kv/myapp/token")
+		require.NoError(t, err)
+		require.Equal(t, "tok", actual)
+		_, err = client.Get("kv/myapp/token")
+		require.NoError(t, err)
+		require.Equal(t, 1, strings.Count(strings.Join(f.requests, "\n"), "approle/login"))
+	})
+
+	t.Run("forced kv version", func(t *testing.T) {
+		f := &fakeVault{token: "s.token"}
+		server := newServer(t, f)
+		client := vault.NewClient(&vault.API{Address: server.URL, KVVersion: 1, Token: "s.token"})
+
+		// the secret/ mount is kv v2, so reading it as v1 finds nothing
+		_, err := client.Get("secret/myapp/db")
+		require.ErrorIs(t, err, vault.ErrNotFound)
+	})
+}